@@ -0,0 +1,240 @@
+// Package analytics computes statistics of how a SentencePiece tokenizer
+// encodes text, for comparing tokenizers (e.g. on a new language).
+//
+// The main statistics are the fertility of the tokenizer (the number of
+// tokens per word and per character), the rates of byte-fallback and unknown
+// tokens, and the frequencies of the pieces used.
+package analytics
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"io"
+	"math/bits"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/eliben/go-sentencepiece"
+)
+
+// Stats are the statistics of encoding a corpus with a tokenizer.
+type Stats struct {
+	// Name identifies the corpus, e.g. its language or file name.
+	Name string
+
+	// Lines, Words, Chars and Bytes are the sizes of the corpus. Words are
+	// sequences of non-whitespace characters; Chars counts Unicode code
+	// points.
+	Lines, Words, Chars, Bytes int
+
+	// Tokens is the number of tokens the corpus is encoded to. Of these,
+	// ByteTokens are byte-fallback tokens and UnknownTokens are the unknown
+	// token.
+	Tokens, ByteTokens, UnknownTokens int
+
+	// PieceCounts maps the ID of each piece used in the encoded corpus to the
+	// number of times it's used.
+	PieceCounts map[int]int
+
+	// VocabularySize is the size of the tokenizer's vocabulary.
+	VocabularySize int
+}
+
+// Analyzer accumulates the statistics of encoding text with a Processor.
+// Create one with [NewAnalyzer].
+type Analyzer struct {
+	proc   *sentencepiece.Processor
+	isByte []bool
+	unkID  int
+	stats  Stats
+}
+
+// NewAnalyzer creates an Analyzer for text encoded with proc; name is the
+// name of the resulting Stats.
+func NewAnalyzer(proc *sentencepiece.Processor, name string) *Analyzer {
+	vocab := proc.Model().Vocabulary()
+	isByte := make([]bool, len(vocab))
+	for i, p := range vocab {
+		isByte[i] = p.Type == "BYTE"
+	}
+	return &Analyzer{
+		proc:   proc,
+		isByte: isByte,
+		unkID:  proc.ModelInfo().UnknownID,
+		stats: Stats{
+			Name:           name,
+			PieceCounts:    make(map[int]int),
+			VocabularySize: len(vocab),
+		},
+	}
+}
+
+// Add encodes text and adds it to the statistics. text is counted as a single
+// line; to add a text of several lines, use [Analyzer.AddReader].
+func (a *Analyzer) Add(text string) {
+	s := &a.stats
+	s.Lines++
+	s.Words += len(strings.Fields(text))
+	s.Chars += utf8.RuneCountInString(text)
+	s.Bytes += len(text)
+
+	for _, tok := range a.proc.Encode(text) {
+		s.Tokens++
+		s.PieceCounts[tok.ID]++
+		switch {
+		case tok.ID == a.unkID:
+			s.UnknownTokens++
+		case tok.ID >= 0 && tok.ID < len(a.isByte) && a.isByte[tok.ID]:
+			s.ByteTokens++
+		}
+	}
+}
+
+// AddReader reads text from r until EOF, and adds each of its lines
+// (including its line break) to the statistics.
+func (a *Analyzer) AddReader(r io.Reader) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			a.Add(line)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// Stats returns the statistics accumulated so far. The result is a copy,
+// which isn't affected by later calls to the Analyzer.
+func (a *Analyzer) Stats() *Stats {
+	s := a.stats
+	s.PieceCounts = make(map[int]int, len(a.stats.PieceCounts))
+	for id, n := range a.stats.PieceCounts {
+		s.PieceCounts[id] = n
+	}
+	return &s
+}
+
+// Analyze is a convenience function that encodes the text read from r with
+// proc, and returns the statistics of the result.
+func Analyze(proc *sentencepiece.Processor, name string, r io.Reader) (*Stats, error) {
+	a := NewAnalyzer(proc, name)
+	if err := a.AddReader(r); err != nil {
+		return nil, err
+	}
+	return a.Stats(), nil
+}
+
+// Merge adds the statistics in other to s, e.g. to aggregate the statistics
+// of several files in the same language. Both must be computed with the same
+// tokenizer.
+func (s *Stats) Merge(other *Stats) {
+	s.Lines += other.Lines
+	s.Words += other.Words
+	s.Chars += other.Chars
+	s.Bytes += other.Bytes
+	s.Tokens += other.Tokens
+	s.ByteTokens += other.ByteTokens
+	s.UnknownTokens += other.UnknownTokens
+	if s.PieceCounts == nil {
+		s.PieceCounts = make(map[int]int, len(other.PieceCounts))
+	}
+	for id, n := range other.PieceCounts {
+		s.PieceCounts[id] += n
+	}
+	s.VocabularySize = max(s.VocabularySize, other.VocabularySize)
+}
+
+// TokensPerWord returns the average number of tokens per word, or 0 if there
+// are no words.
+func (s *Stats) TokensPerWord() float64 {
+	return ratio(s.Tokens, s.Words)
+}
+
+// TokensPerChar returns the average number of tokens per character, or 0 if
+// there are no characters.
+func (s *Stats) TokensPerChar() float64 {
+	return ratio(s.Tokens, s.Chars)
+}
+
+// BytesPerToken returns the average number of bytes of text encoded by each
+// token (a common measure of compression), or 0 if there are no tokens.
+func (s *Stats) BytesPerToken() float64 {
+	return ratio(s.Bytes, s.Tokens)
+}
+
+// ByteFallbackRate returns the fraction of tokens that are byte-fallback
+// tokens.
+func (s *Stats) ByteFallbackRate() float64 {
+	return ratio(s.ByteTokens, s.Tokens)
+}
+
+// UnknownRate returns the fraction of tokens that are the unknown token.
+func (s *Stats) UnknownRate() float64 {
+	return ratio(s.UnknownTokens, s.Tokens)
+}
+
+// VocabularyCoverage returns the fraction of the vocabulary's pieces that are
+// used in the encoded corpus.
+func (s *Stats) VocabularyCoverage() float64 {
+	return ratio(len(s.PieceCounts), s.VocabularySize)
+}
+
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// PieceCount is the number of uses of a piece.
+type PieceCount struct {
+	ID    int
+	Count int
+}
+
+// TopPieces returns the n most frequently used pieces, most frequent first;
+// pieces with the same count are ordered by ID. n < 0 returns all the pieces
+// used.
+func (s *Stats) TopPieces(n int) []PieceCount {
+	counts := make([]PieceCount, 0, len(s.PieceCounts))
+	for id, count := range s.PieceCounts {
+		counts = append(counts, PieceCount{ID: id, Count: count})
+	}
+	slices.SortFunc(counts, func(a, b PieceCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.ID, b.ID))
+	})
+	if n >= 0 && n < len(counts) {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// HistogramBucket is a bucket of a piece frequency histogram: the number of
+// distinct pieces used between Min and Max times (inclusive).
+type HistogramBucket struct {
+	Min    int `json:"min"`
+	Max    int `json:"max"`
+	Pieces int `json:"pieces"`
+}
+
+// Histogram returns the histogram of piece frequencies, with buckets for
+// pieces used 1, 2-3, 4-7, 8-15 times and so on, up to the bucket of the most
+// frequent piece. Empty buckets are included.
+func (s *Stats) Histogram() []HistogramBucket {
+	var buckets []HistogramBucket
+	for _, count := range s.PieceCounts {
+		b := bits.Len(uint(count)) - 1
+		for len(buckets) <= b {
+			lo := 1 << len(buckets)
+			buckets = append(buckets, HistogramBucket{Min: lo, Max: 2*lo - 1})
+		}
+		buckets[b].Pieces++
+	}
+	return buckets
+}
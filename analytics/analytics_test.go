@@ -0,0 +1,140 @@
+package analytics
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eliben/go-sentencepiece"
+)
+
+func createProcessor(t testing.TB) *sentencepiece.Processor {
+	t.Helper()
+	protoFile := os.Getenv("MODELPATH")
+	if protoFile == "" {
+		t.Fatal("Need MODELPATH env var to run tests")
+	}
+	proc, err := sentencepiece.NewProcessorFromPath(protoFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proc
+}
+
+const corpus = `Language: English
+
+Credits: Produced by David Widger
+if allow == true { return x;} else {return x+y;}
+Bienvenido a este proyecto
+hiƻ 🤨there ⇲bob, สวัสดี 𝔘𝔫𝔦𝔠𝔬𝔡𝔢`
+
+func TestAnalyze(t *testing.T) {
+	proc := createProcessor(t)
+	s, err := Analyze(proc, "corpus", strings.NewReader(corpus))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.SplitAfter(corpus, "\n")
+	var wantTokens, wantBytes, wantUnknown int
+	wantCounts := make(map[int]int)
+	vocab := proc.Model().Vocabulary()
+	for _, line := range lines {
+		for _, tok := range proc.Encode(line) {
+			wantTokens++
+			wantCounts[tok.ID]++
+			if tok.ID == proc.ModelInfo().UnknownID {
+				wantUnknown++
+			} else if vocab[tok.ID].Type == "BYTE" {
+				wantBytes++
+			}
+		}
+	}
+
+	want := &Stats{
+		Name:           "corpus",
+		Lines:          len(lines),
+		Words:          len(strings.Fields(corpus)),
+		Chars:          len([]rune(corpus)),
+		Bytes:          len(corpus),
+		Tokens:         wantTokens,
+		ByteTokens:     wantBytes,
+		UnknownTokens:  wantUnknown,
+		PieceCounts:    wantCounts,
+		VocabularySize: len(vocab),
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("got %+v, want %+v", s, want)
+	}
+
+	if got, want := s.TokensPerWord(), float64(s.Tokens)/float64(s.Words); got != want {
+		t.Errorf("got TokensPerWord %v, want %v", got, want)
+	}
+	if got, want := s.ByteFallbackRate(), float64(s.ByteTokens)/float64(s.Tokens); got != want {
+		t.Errorf("got ByteFallbackRate %v, want %v", got, want)
+	}
+	if got := (&Stats{}).TokensPerChar(); got != 0 {
+		t.Errorf("got TokensPerChar %v for empty stats, want 0", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	proc := createProcessor(t)
+	lines := strings.SplitAfter(corpus, "\n")
+	mid := len(lines) / 2
+
+	whole, err := Analyze(proc, "all", strings.NewReader(corpus))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged := &Stats{Name: "all"}
+	for _, part := range []string{strings.Join(lines[:mid], ""), strings.Join(lines[mid:], "")} {
+		s, err := Analyze(proc, "part", strings.NewReader(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+		merged.Merge(s)
+	}
+	if !reflect.DeepEqual(merged, whole) {
+		t.Errorf("got %+v, want %+v", merged, whole)
+	}
+}
+
+func TestAnalyzerStatsCopy(t *testing.T) {
+	proc := createProcessor(t)
+	a := NewAnalyzer(proc, "text")
+	a.Add("hello world")
+	s := a.Stats()
+	want := a.Stats()
+	a.Add("hello world")
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("stats changed by later Add: got %+v, want %+v", s, want)
+	}
+	if got := a.Stats().Tokens; got != 2*s.Tokens {
+		t.Errorf("got %d tokens, want %d", got, 2*s.Tokens)
+	}
+}
+
+func TestTopPiecesAndHistogram(t *testing.T) {
+	s := &Stats{PieceCounts: map[int]int{10: 1, 11: 5, 12: 5, 13: 2, 14: 9}}
+
+	wantTop := []PieceCount{{14, 9}, {11, 5}, {12, 5}}
+	if got := s.TopPieces(3); !reflect.DeepEqual(got, wantTop) {
+		t.Errorf("got top pieces %v, want %v", got, wantTop)
+	}
+	if got := s.TopPieces(-1); len(got) != len(s.PieceCounts) {
+		t.Errorf("got %d pieces, want %d", len(got), len(s.PieceCounts))
+	}
+
+	wantHist := []HistogramBucket{
+		{Min: 1, Max: 1, Pieces: 1},
+		{Min: 2, Max: 3, Pieces: 1},
+		{Min: 4, Max: 7, Pieces: 2},
+		{Min: 8, Max: 15, Pieces: 1},
+	}
+	if got := s.Histogram(); !reflect.DeepEqual(got, wantHist) {
+		t.Errorf("got histogram %v, want %v", got, wantHist)
+	}
+}
@@ -27,6 +27,26 @@ func BenchmarkEncoder(b *testing.B) {
 	b.ReportMetric(float64(total)/float64(b.Elapsed().Seconds()), "tokens/sec")
 }
 
+func BenchmarkEncoderWordCache(b *testing.B) {
+	buf, err := ioutil.ReadFile(filepath.Join("test", "pg7193_english.txt"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	sbuf := string(buf)
+
+	proc := NewProcessorFromModel(createProcessor(b).Model(), WithWordCache(10000))
+	b.ResetTimer()
+	total := 0
+
+	for range b.N {
+		toks := proc.Encode(sbuf)
+		total += len(toks)
+	}
+	runtime.KeepAlive(total)
+
+	b.ReportMetric(float64(total)/float64(b.Elapsed().Seconds()), "tokens/sec")
+}
+
 func BenchmarkDecoder(b *testing.B) {
 	buf, err := ioutil.ReadFile(filepath.Join("test", "pg7193_english.txt"))
 	if err != nil {
@@ -48,3 +68,27 @@ func BenchmarkDecoder(b *testing.B) {
 
 	b.ReportMetric(float64(len(toks)*b.N)/float64(b.Elapsed().Seconds()), "tokens/sec")
 }
+
+func BenchmarkLoadModel(b *testing.B) {
+	protoData, err := ioutil.ReadFile(modelPath(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+	_, compiledData := compileModel(b)
+
+	for _, bb := range []struct {
+		name string
+		data []byte
+	}{
+		{"proto", protoData},
+		{"compiled", compiledData},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			for range b.N {
+				if _, err := LoadModelFromBytes(bb.data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
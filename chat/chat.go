@@ -0,0 +1,192 @@
+// Package chat renders and tokenizes conversations with the Gemma chat
+// template:
+//
+//	<start_of_turn>user
+//	What is Go?<end_of_turn>
+//	<start_of_turn>model
+//	Go is a programming language.<end_of_turn>
+//
+// The turn markers are tokenized as the model's special pieces, while in the
+// content of messages they're tokenized as plain text: a message containing
+// "<start_of_turn>" or "<end_of_turn>" can't inject turn markers into the
+// conversation.
+package chat
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/eliben/go-sentencepiece"
+)
+
+// Roles of messages in a conversation.
+const (
+	RoleUser  = "user"
+	RoleModel = "model"
+
+	// RoleSystem is the role of system instructions. Gemma has no system
+	// turns, so a system message is allowed only as the first message of a
+	// conversation; its content is prepended to the first user message.
+	RoleSystem = "system"
+
+	// RoleAssistant is accepted as an alias of RoleModel, for compatibility
+	// with other chat APIs.
+	RoleAssistant = "assistant"
+)
+
+const (
+	startOfTurn = "<start_of_turn>"
+	endOfTurn   = "<end_of_turn>"
+)
+
+// Message is a message in a conversation.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// turn is a message in the form it's rendered in: with a Gemma role and
+// trimmed content.
+type turn struct {
+	role, content string
+}
+
+// turns validates messages and converts them to turns. Following Gemma's
+// template, messages must alternate between user and model turns, starting
+// with a user turn (after an optional system message), and their content is
+// trimmed of surrounding whitespace.
+func turns(messages []Message) ([]turn, error) {
+	var system string
+	if len(messages) > 0 && messages[0].Role == RoleSystem {
+		system = strings.TrimSpace(messages[0].Content)
+		messages = messages[1:]
+	}
+
+	ts := make([]turn, len(messages))
+	for i, msg := range messages {
+		role := msg.Role
+		if role == RoleAssistant {
+			role = RoleModel
+		}
+		wantRole := RoleUser
+		if i%2 == 1 {
+			wantRole = RoleModel
+		}
+		switch {
+		case role == RoleSystem:
+			return nil, fmt.Errorf("message %d: system message must be the first message", i)
+		case role != RoleUser && role != RoleModel:
+			return nil, fmt.Errorf("message %d: unknown role %q", i, msg.Role)
+		case role != wantRole:
+			return nil, fmt.Errorf("message %d: got role %q, want %q; roles must alternate user/model/user/...", i, msg.Role, wantRole)
+		}
+		ts[i] = turn{role: role, content: strings.TrimSpace(msg.Content)}
+	}
+
+	if system != "" {
+		if len(ts) == 0 {
+			return nil, fmt.Errorf("system message without a user message")
+		}
+		ts[0].content = system + "\n\n" + ts[0].content
+	}
+	return ts, nil
+}
+
+// Render renders messages with the Gemma chat template, as text. If
+// addGenerationPrompt is true, the start of a model turn is appended, to
+// prompt the model to respond.
+//
+// The result doesn't start with the BOS token, which isn't text; note that
+// encoding it with a Processor lets message content inject turn markers.
+// Use [Encoder] to tokenize conversations.
+func Render(messages []Message, addGenerationPrompt bool) (string, error) {
+	ts, err := turns(messages)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, t := range ts {
+		sb.WriteString(startOfTurn + t.role + "\n" + t.content + endOfTurn + "\n")
+	}
+	if addGenerationPrompt {
+		sb.WriteString(startOfTurn + RoleModel + "\n")
+	}
+	return sb.String(), nil
+}
+
+// Encoder tokenizes conversations with the Gemma chat template.
+type Encoder struct {
+	proc *sentencepiece.Processor
+
+	bosID, startOfTurnID, endOfTurnID int
+}
+
+// NewEncoder creates an Encoder for the given model, which must have the
+// Gemma turn marker pieces. opts are passed to the Processor used to encode
+// the content of messages.
+//
+// Exactly two symbols are protected from message content: "<start_of_turn>"
+// and "<end_of_turn>" (see [sentencepiece.WithDisabledSymbols]). Control
+// pieces, like "<bos>" and "<eos>", are never produced from text anyway.
+// Other user-defined pieces of the model are still matched in content as
+// usual, since Gemma tokenizes text with them: these include whitespace runs
+// and HTML tags, but also special tokens like "<mask>" and "<start_of_image>".
+// To keep such tokens out of message content too, pass them in
+// WithDisabledSymbols options.
+func NewEncoder(m *sentencepiece.Model, opts ...sentencepiece.Option) (*Encoder, error) {
+	opts = append(slices.Clip(opts), sentencepiece.WithDisabledSymbols(startOfTurn, endOfTurn))
+	proc := sentencepiece.NewProcessorFromModel(m, opts...)
+
+	e := &Encoder{proc: proc, bosID: proc.ModelInfo().BeginningOfSentenceID}
+	if e.bosID < 0 {
+		return nil, fmt.Errorf("model has no BOS piece")
+	}
+	var ok bool
+	if e.startOfTurnID, ok = proc.PieceToID(startOfTurn); !ok {
+		return nil, fmt.Errorf("model has no %s piece", startOfTurn)
+	}
+	if e.endOfTurnID, ok = proc.PieceToID(endOfTurn); !ok {
+		return nil, fmt.Errorf("model has no %s piece", endOfTurn)
+	}
+	return e, nil
+}
+
+// Encode renders messages with the Gemma chat template, as [Render] does, and
+// returns the token IDs of the result, starting with the BOS token.
+//
+// The turn markers are always the model's special pieces, and the content of
+// messages never produces turn markers or control tokens; see [NewEncoder]
+// for other special tokens.
+func (e *Encoder) Encode(messages []Message, addGenerationPrompt bool) ([]int, error) {
+	ts, err := turns(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []int{e.bosID}
+	for _, t := range ts {
+		ids = append(ids, e.startOfTurnID)
+		ids = e.appendText(ids, t.role+"\n"+t.content)
+		ids = append(ids, e.endOfTurnID)
+		ids = e.appendText(ids, "\n")
+	}
+	if addGenerationPrompt {
+		ids = append(ids, e.startOfTurnID)
+		ids = e.appendText(ids, RoleModel+"\n")
+	}
+	return ids, nil
+}
+
+func (e *Encoder) appendText(ids []int, text string) []int {
+	for _, tok := range e.proc.Encode(text) {
+		ids = append(ids, tok.ID)
+	}
+	return ids
+}
+
+// EndOfTurnID returns the ID of the end-of-turn token, which ends the model's
+// response when generating text.
+func (e *Encoder) EndOfTurnID() int {
+	return e.endOfTurnID
+}
@@ -0,0 +1,285 @@
+package sentencepiece
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"unsafe"
+
+	"github.com/eliben/go-sentencepiece/internal/doublearray"
+	"github.com/eliben/go-sentencepiece/internal/model"
+	"github.com/eliben/go-sentencepiece/internal/prefixmatcher"
+	"google.golang.org/protobuf/proto"
+)
+
+// The precompiled model format is a flat, little-endian serialization of the
+// lookup structures of a Model. Loading it doesn't require unmarshaling the
+// pieces or rebuilding any maps: the tables are used in place, directly from
+// the loaded (or memory-mapped) data.
+//
+// The layout is:
+//
+//	magic           [4]byte  "GSPM"
+//	version         uint32
+//	numPieces       uint32
+//	unknownID       uint32
+//	numSections     uint32
+//	sections        [numSections]struct{ offset, length uint32 }
+//
+// followed by the data of the sections, each aligned to 8 bytes. The sections
+// are listed below, in order.
+const (
+	compiledMagic   = "GSPM"
+	compiledVersion = 3
+)
+
+const (
+	// Model proto without the pieces: trainer spec, normalizer spec, etc.
+	sectionSpec = iota
+	// The piece table: see the Model type.
+	sectionPieceOffsets
+	sectionPieceText
+	sectionPieceScores
+	sectionPieceTypes
+	// Units of the double-array tries; see doublearray.Trie.Units.
+	sectionNormalTrie
+	sectionReservedTrie
+	sectionUserDefinedTrie
+	// IDs of byte pieces for each value 0-255, or 0xFFFFFFFF.
+	sectionByteIDs
+
+	numSections
+)
+
+const compiledHeaderSize = 20 + numSections*8
+
+// WriteCompiled writes the model to w in a precompiled format. Models in this
+// format are loaded by the LoadModel* functions much faster than the model
+// proto, and can be used directly from a memory-mapped file (see
+// [LoadModelMmap]).
+//
+// The price of the fast loading is size: besides the pieces, the precompiled
+// model has the lookup tries, packed in 4-byte units like in Darts, so it's
+// about 1.7x larger than the model proto. Where size matters more than load
+// time, such as for models embedded in a WASM binary, the model proto is the
+// better choice.
+//
+// The precompiled format is specific to this package and may change between
+// its versions; it should be produced from the model proto as a build step,
+// rather than used for distributing models.
+func (m *Model) WriteCompiled(w io.Writer) error {
+	spec := proto.Clone(m.proto).(*model.ModelProto)
+	spec.Pieces = nil
+	specData, err := proto.MarshalOptions{Deterministic: true}.Marshal(spec)
+	if err != nil {
+		return fmt.Errorf("unable to marshal model spec: %v", err)
+	}
+
+	byteIDs := make([]uint32, 256)
+	for bv, tok := range m.byte2Token {
+		if tok.Text == "" {
+			byteIDs[bv] = ^uint32(0)
+		} else {
+			byteIDs[bv] = uint32(tok.ID)
+		}
+	}
+
+	scores := make([]byte, 0, 4*len(m.pieceScores))
+	for _, score := range m.pieceScores {
+		scores = binary.LittleEndian.AppendUint32(scores, math.Float32bits(score))
+	}
+
+	sections := [numSections][]byte{
+		sectionSpec:            specData,
+		sectionPieceOffsets:    appendUint32s(nil, m.pieceOffsets),
+		sectionPieceText:       []byte(m.pieceText),
+		sectionPieceScores:     scores,
+		sectionPieceTypes:      m.pieceTypes,
+		sectionNormalTrie:      appendUint32s(nil, m.normalTrie.Units()),
+		sectionReservedTrie:    appendUint32s(nil, m.reservedTrie.Units()),
+		sectionUserDefinedTrie: appendUint32s(nil, m.userDefinedMatcher.Units()),
+		sectionByteIDs:         appendUint32s(nil, byteIDs),
+	}
+
+	var buf bytes.Buffer
+	header := make([]byte, 0, compiledHeaderSize)
+	header = append(header, compiledMagic...)
+	header = binary.LittleEndian.AppendUint32(header, compiledVersion)
+	header = binary.LittleEndian.AppendUint32(header, uint32(m.numPieces()))
+	header = binary.LittleEndian.AppendUint32(header, uint32(m.unknownID))
+	header = binary.LittleEndian.AppendUint32(header, numSections)
+
+	offset := alignTo8(compiledHeaderSize)
+	for _, data := range sections {
+		header = binary.LittleEndian.AppendUint32(header, uint32(offset))
+		header = binary.LittleEndian.AppendUint32(header, uint32(len(data)))
+		offset = alignTo8(offset + len(data))
+	}
+	buf.Write(header)
+
+	for _, data := range sections {
+		buf.Write(make([]byte, alignTo8(buf.Len())-buf.Len()))
+		buf.Write(data)
+	}
+
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// isCompiledModel reports whether data looks like a precompiled model.
+func isCompiledModel(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(compiledMagic))
+}
+
+var errCorruptCompiled = errors.New("corrupt precompiled model")
+
+// loadCompiledModel loads a Model from precompiled model data written by
+// WriteCompiled. The returned Model refers to data directly, so it should not
+// be modified later.
+func loadCompiledModel(data []byte) (*Model, error) {
+	if len(data) < compiledHeaderSize || !isCompiledModel(data) {
+		return nil, errCorruptCompiled
+	}
+	header := data[len(compiledMagic):]
+	readHeader := func() uint32 {
+		v := binary.LittleEndian.Uint32(header)
+		header = header[4:]
+		return v
+	}
+
+	if version := readHeader(); version != compiledVersion {
+		return nil, fmt.Errorf("unsupported precompiled model version %d", version)
+	}
+	numPieces := int(readHeader())
+	unknownID := int(int32(readHeader()))
+	if readHeader() != numSections {
+		return nil, errCorruptCompiled
+	}
+
+	var sections [numSections][]byte
+	for i := range sections {
+		offset, length := uint64(readHeader()), uint64(readHeader())
+		if offset%8 != 0 || offset+length > uint64(len(data)) {
+			return nil, errCorruptCompiled
+		}
+		sections[i] = data[offset : offset+length]
+	}
+
+	var spec model.ModelProto
+	if err := proto.Unmarshal(sections[sectionSpec], &spec); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal model spec: %v", err)
+	}
+	if err := checkModelSpecs(&spec); err != nil {
+		return nil, err
+	}
+
+	m := &Model{
+		proto:        &spec,
+		pieceOffsets: uint32s(sections[sectionPieceOffsets]),
+		pieceText:    unsafeString(sections[sectionPieceText]),
+		pieceScores:  float32s(sections[sectionPieceScores]),
+		pieceTypes:   sections[sectionPieceTypes],
+		unknownID:    unknownID,
+	}
+
+	// Validate the tables, so that lookups into a corrupt model can't go out
+	// of bounds.
+	if len(m.pieceOffsets) != numPieces+1 || len(m.pieceScores) != numPieces || len(m.pieceTypes) != numPieces {
+		return nil, errCorruptCompiled
+	}
+	if m.pieceOffsets[0] != 0 || int(m.pieceOffsets[numPieces]) != len(m.pieceText) {
+		return nil, errCorruptCompiled
+	}
+	for i := 0; i < numPieces; i++ {
+		if m.pieceOffsets[i+1] < m.pieceOffsets[i] {
+			return nil, errCorruptCompiled
+		}
+	}
+	if unknownID < 0 || unknownID >= numPieces {
+		return nil, errCorruptCompiled
+	}
+
+	byteIDs := uint32s(sections[sectionByteIDs])
+	if len(byteIDs) != 256 {
+		return nil, errCorruptCompiled
+	}
+	for bv, id := range byteIDs {
+		if id == ^uint32(0) {
+			continue
+		}
+		if int(id) >= numPieces {
+			return nil, errCorruptCompiled
+		}
+		m.byte2Token[bv] = Token{ID: int(id), Text: m.pieceString(int(id))}
+	}
+	m.initIDToByte()
+
+	// The tries are used as they are; lookups in them are range-checked (see
+	// nodePiece), so they don't need validation.
+	var err error
+	if m.normalTrie, err = doublearray.FromUnits(uint32s(sections[sectionNormalTrie])); err != nil {
+		return nil, errCorruptCompiled
+	}
+	if m.reservedTrie, err = doublearray.FromUnits(uint32s(sections[sectionReservedTrie])); err != nil {
+		return nil, errCorruptCompiled
+	}
+	if m.userDefinedMatcher, err = prefixmatcher.NewFromUnits(uint32s(sections[sectionUserDefinedTrie])); err != nil {
+		return nil, errCorruptCompiled
+	}
+	if err := m.initNormalizers(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func alignTo8(n int) int {
+	return (n + 7) &^ 7
+}
+
+func appendUint32s(b []byte, vs []uint32) []byte {
+	for _, v := range vs {
+		b = binary.LittleEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+// nativeLittleEndian is true if the host's byte order is little-endian, which
+// lets us use the precompiled tables in place.
+var nativeLittleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+// uint32s returns the little-endian uint32 values in b. When possible, the
+// returned slice aliases b; otherwise the values are copied.
+func uint32s(b []byte) []uint32 {
+	n := len(b) / 4
+	if n == 0 {
+		return nil
+	}
+	if nativeLittleEndian && uintptr(unsafe.Pointer(&b[0]))%4 == 0 {
+		return unsafe.Slice((*uint32)(unsafe.Pointer(&b[0])), n)
+	}
+	vs := make([]uint32, n)
+	for i := range vs {
+		vs[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	return vs
+}
+
+// float32s is like uint32s, for float32 values.
+func float32s(b []byte) []float32 {
+	us := uint32s(b)
+	if len(us) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*float32)(unsafe.Pointer(&us[0])), len(us))
+}
+
+// unsafeString returns a string that shares its data with b.
+func unsafeString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(&b[0], len(b))
+}
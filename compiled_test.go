@@ -0,0 +1,102 @@
+package sentencepiece
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// compileModel loads the model proto and returns it along with its
+// precompiled form.
+func compileModel(t testing.TB) (*Model, []byte) {
+	t.Helper()
+	m, err := LoadModelFromPath(modelPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := m.WriteCompiled(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return m, buf.Bytes()
+}
+
+func TestCompiledRoundTrip(t *testing.T) {
+	m, data := compileModel(t)
+
+	compiledPath := filepath.Join(t.TempDir(), "tokenizer.spmc")
+	if err := os.WriteFile(compiledPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadModelFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapped, err := LoadModelMmap(compiledPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join("test", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc := NewProcessorFromModel(m)
+	for name, cm := range map[string]*Model{"bytes": loaded, "mmap": mapped} {
+		compiledProc := NewProcessorFromModel(cm)
+
+		if got, want := *compiledProc.ModelInfo(), *proc.ModelInfo(); got != want {
+			t.Errorf("%s: got info %v, want %v", name, got, want)
+		}
+
+		for _, path := range paths {
+			buf, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			text := string(buf)
+
+			want := proc.Encode(text)
+			got := compiledProc.Encode(text)
+			if !slices.Equal(got, want) {
+				t.Errorf("%s: %s: Encode results differ", name, path)
+			}
+
+			if newText := compiledProc.DecodeTokens(got); newText != text {
+				t.Errorf("%s: %s: text mismatch after Decode", name, path)
+			}
+		}
+	}
+
+	// Compiling a compiled model again produces the same data.
+	var buf bytes.Buffer
+	if err := loaded.WriteCompiled(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("recompiled model differs")
+	}
+}
+
+func TestCompiledCorrupt(t *testing.T) {
+	_, data := compileModel(t)
+
+	// Truncating the data anywhere must produce an error rather than a model
+	// that panics on use.
+	for _, n := range []int{4, compiledHeaderSize - 1, compiledHeaderSize, len(data) / 2, len(data) - 1} {
+		if _, err := LoadModelFromBytes(data[:n]); err == nil {
+			t.Errorf("expected error for data truncated to %d bytes", n)
+		}
+	}
+
+	badVersion := slices.Clone(data)
+	badVersion[4] = 0xff
+	if _, err := LoadModelFromBytes(badVersion); err == nil {
+		t.Errorf("expected error for bad version")
+	}
+}
@@ -0,0 +1,210 @@
+package sentencepiece
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ModelDiff describes the differences between two models; see [DiffModels].
+type ModelDiff struct {
+	// Added and Removed are the pieces found only in the new or the old model,
+	// respectively, sorted by ID.
+	Added, Removed []PieceInfo
+
+	// Renumbered, ScoreChanged and TypeChanged are the pieces found in both
+	// models that have a different ID, score or type in the new model, sorted
+	// by their old ID. A piece may appear in several of these lists.
+	Renumbered, ScoreChanged, TypeChanged []PieceChange
+
+	// SpecChanges are the differences in the settings of the models (the
+	// trainer, normalizer and denormalizer specs, etc.), in the order of the
+	// fields in the model proto.
+	SpecChanges []SpecChange
+}
+
+// PieceInfo describes a piece in a model's vocabulary.
+type PieceInfo struct {
+	ID    int     `json:"id"`
+	Piece string  `json:"piece"`
+	Score float32 `json:"score"`
+	// Type is the name of the piece's type in the model proto, such as
+	// "NORMAL" or "CONTROL".
+	Type string `json:"type,omitempty"`
+}
+
+// PieceChange describes a piece found in two models, as it appears in each.
+type PieceChange struct {
+	Old, New PieceInfo
+}
+
+// SpecChange describes a setting that differs between two models. Field is
+// the path of the field in the model proto, such as
+// "normalizer_spec.add_dummy_prefix"; Old and New are its values, formatted
+// as text.
+type SpecChange struct {
+	Field    string
+	Old, New string
+}
+
+// DiffModels compares two models: their vocabularies and their settings.
+// Pieces are matched between the models by their text; if a model has several
+// pieces with the same text, only the one with the highest ID is compared.
+func DiffModels(oldModel, newModel *Model) *ModelDiff {
+	d := &ModelDiff{}
+
+	oldIDs := pieceIDsByText(oldModel)
+	newIDs := pieceIDsByText(newModel)
+
+	for text, oldID := range oldIDs {
+		newID, ok := newIDs[text]
+		if !ok {
+			d.Removed = append(d.Removed, oldModel.pieceInfo(oldID))
+			continue
+		}
+		change := PieceChange{Old: oldModel.pieceInfo(oldID), New: newModel.pieceInfo(newID)}
+		if change.Old.ID != change.New.ID {
+			d.Renumbered = append(d.Renumbered, change)
+		}
+		if change.Old.Score != change.New.Score {
+			d.ScoreChanged = append(d.ScoreChanged, change)
+		}
+		if change.Old.Type != change.New.Type {
+			d.TypeChanged = append(d.TypeChanged, change)
+		}
+	}
+	for text, newID := range newIDs {
+		if _, ok := oldIDs[text]; !ok {
+			d.Added = append(d.Added, newModel.pieceInfo(newID))
+		}
+	}
+
+	byID := func(a, b PieceInfo) int { return a.ID - b.ID }
+	byOldID := func(a, b PieceChange) int { return a.Old.ID - b.Old.ID }
+	slices.SortFunc(d.Added, byID)
+	slices.SortFunc(d.Removed, byID)
+	slices.SortFunc(d.Renumbered, byOldID)
+	slices.SortFunc(d.ScoreChanged, byOldID)
+	slices.SortFunc(d.TypeChanged, byOldID)
+
+	diffSpecs("", oldModel.proto.ProtoReflect(), newModel.proto.ProtoReflect(), &d.SpecChanges)
+	return d
+}
+
+// Empty reports whether the diff has no differences.
+func (d *ModelDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Renumbered) == 0 &&
+		len(d.ScoreChanged) == 0 && len(d.TypeChanged) == 0 && len(d.SpecChanges) == 0
+}
+
+// pieceIDsByText maps the text of each of m's pieces to its ID.
+func pieceIDsByText(m *Model) map[string]int {
+	ids := make(map[string]int, m.numPieces())
+	for id := range m.numPieces() {
+		ids[m.pieceString(id)] = id
+	}
+	return ids
+}
+
+func (m *Model) pieceInfo(id int) PieceInfo {
+	return PieceInfo{
+		ID:    id,
+		Piece: m.pieceString(id),
+		Score: m.pieceScores[id],
+		Type:  m.pieceType(id).String(),
+	}
+}
+
+// diffSpecs appends the differences between messages a and b of the same
+// type to changes. The pieces of the model proto aren't compared, since the
+// piece table is compared separately (and compiled models don't have them in
+// their proto).
+func diffSpecs(prefix string, a, b protoreflect.Message, changes *[]SpecChange) {
+	fields := a.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		name := prefix + string(fd.Name())
+		if prefix == "" && name == "pieces" {
+			continue
+		}
+		if fd.Message() != nil && fd.Cardinality() != protoreflect.Repeated {
+			diffSpecs(name+".", a.Get(fd).Message(), b.Get(fd).Message(), changes)
+			continue
+		}
+		// Get returns the default value of unset fields, so setting a field to
+		// its default isn't a change.
+		oldValue, newValue := formatSpecValue(fd, a.Get(fd)), formatSpecValue(fd, b.Get(fd))
+		if oldValue != newValue {
+			*changes = append(*changes, SpecChange{Field: name, Old: oldValue, New: newValue})
+		}
+	}
+}
+
+// formatSpecValue formats the value v of field fd for a SpecChange.
+func formatSpecValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	if fd.IsList() {
+		list := v.List()
+		elems := make([]string, list.Len())
+		for i := range elems {
+			elems[i] = formatSingleSpecValue(fd, list.Get(i))
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	}
+	return formatSingleSpecValue(fd, v)
+}
+
+func formatSingleSpecValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return fmt.Sprintf("%q", v.String())
+	case protoreflect.BytesKind:
+		// Byte fields (like the normalizer's precompiled charsmap) are large;
+		// show their length and a short hash.
+		b := v.Bytes()
+		sum := sha256.Sum256(b)
+		return fmt.Sprintf("%d bytes, sha256 %x...", len(b), sum[:4])
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return fmt.Sprint(v.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return "{" + prototext.MarshalOptions{}.Format(v.Message().Interface()) + "}"
+	default:
+		return v.String()
+	}
+}
+
+// TokenizationDiff summarizes the differences in tokenizing a corpus with two
+// processors; see [CompareTokenization].
+type TokenizationDiff struct {
+	// Texts is the number of texts compared, and ChangedTexts the number of
+	// texts whose tokens differ.
+	Texts, ChangedTexts int
+
+	// OldTokens and NewTokens are the total numbers of tokens produced for all
+	// texts.
+	OldTokens, NewTokens int
+}
+
+// CompareTokenization encodes each of texts with both processors, and
+// summarizes how the results differ. Tokens are compared by their IDs.
+func CompareTokenization(oldProc, newProc *Processor, texts []string) TokenizationDiff {
+	td := TokenizationDiff{Texts: len(texts)}
+	for _, text := range texts {
+		oldTokens := oldProc.Encode(text)
+		newTokens := newProc.Encode(text)
+		td.OldTokens += len(oldTokens)
+		td.NewTokens += len(newTokens)
+
+		sameIDs := func(a, b Token) bool { return a.ID == b.ID }
+		if !slices.EqualFunc(oldTokens, newTokens, sameIDs) {
+			td.ChangedTexts++
+		}
+	}
+	return td
+}
@@ -0,0 +1,125 @@
+package sentencepiece
+
+import (
+	"os"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/eliben/go-sentencepiece/internal/model"
+	"google.golang.org/protobuf/proto"
+)
+
+// loadModelProto loads the model proto the tests run against.
+func loadModelProto(t testing.TB) *model.ModelProto {
+	t.Helper()
+	b, err := os.ReadFile(modelPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mp model.ModelProto
+	if err := proto.Unmarshal(b, &mp); err != nil {
+		t.Fatal(err)
+	}
+	return &mp
+}
+
+func TestDiffModels(t *testing.T) {
+	oldModel, data := compileModel(t)
+	compiled, err := LoadModelFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := DiffModels(oldModel, compiled); !d.Empty() {
+		t.Errorf("got diff %+v for a compiled model, want none", d)
+	}
+
+	// Modify the last pieces of the model: remove the last one, change the
+	// score and type of others, and add a new piece in the middle, which
+	// renumbers all the pieces after it.
+	mp := loadModelProto(t)
+	n := len(mp.Pieces)
+	removed := mp.Pieces[n-1].GetPiece()
+	scoreChanged := mp.Pieces[n-2]
+	scoreChanged.Score = proto.Float32(scoreChanged.GetScore() - 1)
+	typeChanged := mp.Pieces[n-3]
+	typeChanged.Type = model.ModelProto_SentencePiece_UNUSED.Enum()
+	mp.Pieces = mp.Pieces[:n-1]
+	addedAt := n - 10
+	added := &model.ModelProto_SentencePiece{Piece: proto.String("brand new piece"), Score: proto.Float32(-1)}
+	mp.Pieces = append(mp.Pieces[:addedAt], append([]*model.ModelProto_SentencePiece{added}, mp.Pieces[addedAt:]...)...)
+	mp.TrainerSpec.UnkSurface = proto.String("<?>")
+	mp.TrainerSpec.Input = []string{"a.txt", "b.txt"}
+
+	newModel, err := newModel(mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := DiffModels(oldModel, newModel)
+
+	if len(d.Added) != 1 || d.Added[0] != (PieceInfo{ID: addedAt, Piece: "brand new piece", Score: -1, Type: "NORMAL"}) {
+		t.Errorf("got added %v", d.Added)
+	}
+	if len(d.Removed) != 1 || d.Removed[0].Piece != removed || d.Removed[0].ID != n-1 {
+		t.Errorf("got removed %v", d.Removed)
+	}
+	if got, want := len(d.Renumbered), n-1-addedAt; got != want {
+		t.Errorf("got %d renumbered pieces, want %d", got, want)
+	}
+	for _, c := range d.Renumbered {
+		if c.New.ID != c.Old.ID+1 || c.New.Piece != c.Old.Piece {
+			t.Errorf("got renumbered piece %v", c)
+		}
+	}
+	if len(d.ScoreChanged) != 1 || d.ScoreChanged[0].New.Piece != scoreChanged.GetPiece() || d.ScoreChanged[0].New.Score != d.ScoreChanged[0].Old.Score-1 {
+		t.Errorf("got score changes %v", d.ScoreChanged)
+	}
+	if len(d.TypeChanged) != 1 || d.TypeChanged[0].New.Piece != typeChanged.GetPiece() || d.TypeChanged[0].New.Type != "UNUSED" {
+		t.Errorf("got type changes %v", d.TypeChanged)
+	}
+
+	wantSpecChanges := map[string]bool{"trainer_spec.input": true, "trainer_spec.unk_surface": true}
+	if len(d.SpecChanges) != len(wantSpecChanges) {
+		t.Errorf("got spec changes %v", d.SpecChanges)
+	}
+	for _, c := range d.SpecChanges {
+		if !wantSpecChanges[c.Field] || c.Old == c.New {
+			t.Errorf("got unexpected spec change %v", c)
+		}
+	}
+}
+
+func TestCompareTokenization(t *testing.T) {
+	proc := createProcessor(t)
+	texts := []string{"hello world", sampleText, ""}
+
+	td := CompareTokenization(proc, proc, texts)
+	numTokens := 0
+	for _, text := range texts {
+		numTokens += len(proc.Encode(text))
+	}
+	if want := (TokenizationDiff{Texts: 3, OldTokens: numTokens, NewTokens: numTokens}); td != want {
+		t.Errorf("got %+v, want %+v", td, want)
+	}
+
+	// Making a piece of the first text a control piece, which merges can't
+	// produce, changes the tokenization of the first text only.
+	mp := loadModelProto(t)
+	var mergedID = -1
+	for _, tok := range proc.Encode(texts[0]) {
+		if utf8.RuneCountInString(tok.Text) > 1 {
+			mergedID = tok.ID
+		}
+	}
+	if mergedID < 0 {
+		t.Skip("no merged pieces in text")
+	}
+	mp.Pieces[mergedID].Type = model.ModelProto_SentencePiece_CONTROL.Enum()
+	m, err := newModel(mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	td = CompareTokenization(proc, NewProcessorFromModel(m), texts)
+	if td.ChangedTexts != 1 || td.NewTokens <= td.OldTokens {
+		t.Errorf("got %+v, want 1 changed text with more tokens", td)
+	}
+}
@@ -45,3 +45,22 @@ func ExampleDecode() {
 
 	fmt.Println(text)
 }
+
+func ExampleNewProcessorFromModel() {
+	protoFile := os.Getenv("MODELPATH")
+	if protoFile == "" {
+		log.Println("Need MODELPATH env var to run example")
+		return
+	}
+
+	// The model is loaded once and shared by both processors.
+	model, err := sentencepiece.LoadModelFromPath(protoFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	proc1 := sentencepiece.NewProcessorFromModel(model)
+	proc2 := sentencepiece.NewProcessorFromModel(model)
+
+	fmt.Println(proc1.Encode("hello world"))
+	fmt.Println(proc2.Decode([]int{17534, 2134}))
+}
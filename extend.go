@@ -0,0 +1,99 @@
+package sentencepiece
+
+import (
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/eliben/go-sentencepiece/internal/model"
+	"google.golang.org/protobuf/proto"
+)
+
+// ExtendVocabulary returns a new Model with the model's vocabulary extended by
+// pieces; m itself isn't modified. This is useful for adding domain-specific
+// tokens or new control tokens to an existing model, e.g. for fine-tuning.
+//
+// The Type of each new piece must be "USER_DEFINED" (the default if Type is
+// empty) or "CONTROL". User-defined pieces are always encoded as a single
+// token, wherever they appear in the text; control pieces are never produced
+// by Encode, and decode to nothing (like BOS and EOS).
+//
+// The ID of each new piece is either an ID following the existing pieces
+// (the new IDs must be consecutive, but may be given in any order), or the ID
+// of an existing piece of type UNUSED, which the new piece replaces. The text
+// of a new piece must not already be in the vocabulary.
+func (m *Model) ExtendVocabulary(pieces []PieceInfo) (*Model, error) {
+	mp := m.fullProto()
+	existing := pieceIDsByText(m)
+	added := make(map[string]bool)
+
+	pieces = slices.Clone(pieces)
+	slices.SortFunc(pieces, func(a, b PieceInfo) int { return a.ID - b.ID })
+
+	for _, p := range pieces {
+		if p.Piece == "" {
+			return nil, fmt.Errorf("piece %d is empty", p.ID)
+		}
+		if _, ok := existing[p.Piece]; ok || added[p.Piece] {
+			return nil, fmt.Errorf("piece %q is already in the vocabulary", p.Piece)
+		}
+		added[p.Piece] = true
+
+		var pieceType model.ModelProto_SentencePiece_Type
+		switch p.Type {
+		case "", "USER_DEFINED":
+			pieceType = model.ModelProto_SentencePiece_USER_DEFINED
+		case "CONTROL":
+			pieceType = model.ModelProto_SentencePiece_CONTROL
+		default:
+			return nil, fmt.Errorf("piece %q has type %q; want USER_DEFINED or CONTROL", p.Piece, p.Type)
+		}
+
+		newPiece := &model.ModelProto_SentencePiece{
+			Piece: proto.String(p.Piece),
+			Score: proto.Float32(p.Score),
+			Type:  pieceType.Enum(),
+		}
+		switch {
+		case p.ID >= 0 && p.ID < m.numPieces():
+			if m.pieceType(p.ID) != model.ModelProto_SentencePiece_UNUSED {
+				return nil, fmt.Errorf("piece %q: existing piece %d (%q) isn't unused", p.Piece, p.ID, m.pieceString(p.ID))
+			}
+			mp.Pieces[p.ID] = newPiece
+		case p.ID == len(mp.Pieces):
+			mp.Pieces = append(mp.Pieces, newPiece)
+		default:
+			return nil, fmt.Errorf("piece %q: bad ID %d, want an unused piece or %d", p.Piece, p.ID, len(mp.Pieces))
+		}
+	}
+
+	return newModel(mp)
+}
+
+// WriteProto writes the model to w as a serialized model proto, which can be
+// used with any SentencePiece implementation. The model proto is equivalent
+// to the one the model was loaded (or compiled) from, though not necessarily
+// identical byte for byte.
+func (m *Model) WriteProto(w io.Writer) error {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(m.fullProto())
+	if err != nil {
+		return fmt.Errorf("unable to marshal model proto: %v", err)
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// fullProto returns a copy of the model proto, with the pieces taken from the
+// piece table (precompiled models don't have them in their proto).
+func (m *Model) fullProto() *model.ModelProto {
+	mp := proto.Clone(m.proto).(*model.ModelProto)
+	mp.Pieces = make([]*model.ModelProto_SentencePiece, m.numPieces())
+	for id := range mp.Pieces {
+		mp.Pieces[id] = &model.ModelProto_SentencePiece{
+			Piece: proto.String(m.pieceString(id)),
+			Score: proto.Float32(m.pieceScores[id]),
+			Type:  m.pieceType(id).Enum(),
+		}
+	}
+	return mp
+}
@@ -0,0 +1,145 @@
+package sentencepiece
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/eliben/go-sentencepiece/internal/model"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestExtendVocabulary(t *testing.T) {
+	m, data := compileModel(t)
+	compiled, err := LoadModelFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := m.numPieces()
+	text := "say {{name}} then <|sep|> ok"
+
+	for name, base := range map[string]*Model{"proto": m, "compiled": compiled} {
+		t.Run(name, func(t *testing.T) {
+			extended, err := base.ExtendVocabulary([]PieceInfo{
+				{ID: n + 1, Piece: "<|sep|>", Type: "CONTROL"},
+				{ID: n, Piece: "{{name}}"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if base.numPieces() != n {
+				t.Errorf("original model was modified")
+			}
+
+			proc := NewProcessorFromModel(extended)
+			if got := proc.ModelInfo().VocabularySize; got != n+2 {
+				t.Errorf("got vocabulary size %d, want %d", got, n+2)
+			}
+
+			// The user-defined piece is encoded as a single token; the control
+			// piece isn't matched by Encode, and decodes to nothing.
+			tokens := proc.Encode(text)
+			if !slices.Contains(tokens, Token{ID: n, Text: "{{name}}"}) {
+				t.Errorf("user-defined piece not found in %v", tokens)
+			}
+			if id, ok := proc.PieceToID("<|sep|>"); !ok || id != n+1 {
+				t.Errorf("got ID %d, %v for control piece", id, ok)
+			}
+			if got := proc.DecodeTokens(tokens); got != text {
+				t.Errorf("got decoded %q, want %q", got, text)
+			}
+			if got := proc.Decode([]int{n + 1}); got != "" {
+				t.Errorf("control piece decoded to %q", got)
+			}
+
+			// The extended model can be written out and loaded again, in both
+			// formats.
+			var protoBuf, compiledBuf bytes.Buffer
+			if err := extended.WriteProto(&protoBuf); err != nil {
+				t.Fatal(err)
+			}
+			if err := extended.WriteCompiled(&compiledBuf); err != nil {
+				t.Fatal(err)
+			}
+			for _, b := range [][]byte{protoBuf.Bytes(), compiledBuf.Bytes()} {
+				loaded, err := LoadModelFromBytes(b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if loaded.Fingerprint() != extended.Fingerprint() {
+					t.Errorf("fingerprint differs after writing the extended model")
+				}
+			}
+		})
+	}
+}
+
+func TestExtendVocabularyUnused(t *testing.T) {
+	// Mark the last piece as unused, and replace it.
+	mp := loadModelProto(t)
+	n := len(mp.Pieces)
+	mp.Pieces[n-1].Type = model.ModelProto_SentencePiece_UNUSED.Enum()
+	m, err := newModel(mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extended, err := m.ExtendVocabulary([]PieceInfo{{ID: n - 1, Piece: "<new>", Type: "CONTROL"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := extended.pieceInfo(n - 1); got != (PieceInfo{ID: n - 1, Piece: "<new>", Type: "CONTROL"}) {
+		t.Errorf("got piece %v", got)
+	}
+	if extended.numPieces() != n {
+		t.Errorf("got %d pieces, want %d", extended.numPieces(), n)
+	}
+}
+
+func TestExtendVocabularyErrors(t *testing.T) {
+	m, err := LoadModelFromPath(modelPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := m.numPieces()
+	existing := m.pieceString(n - 1)
+
+	for _, pieces := range [][]PieceInfo{
+		{{ID: n, Piece: ""}},
+		{{ID: n, Piece: existing}},
+		{{ID: n, Piece: "a new piece"}, {ID: n + 1, Piece: "a new piece"}},
+		{{ID: n, Piece: "x", Type: "NORMAL"}},
+		{{ID: n + 1, Piece: "gap"}},
+		{{ID: -1, Piece: "negative"}},
+		{{ID: 0, Piece: "replaces a used piece"}},
+	} {
+		if _, err := m.ExtendVocabulary(pieces); err == nil {
+			t.Errorf("%v: expected error", pieces)
+		}
+	}
+}
+
+func TestWriteProto(t *testing.T) {
+	mp := loadModelProto(t)
+	m, err := newModel(proto.Clone(mp).(*model.ModelProto))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := m.WriteProto(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var got model.ModelProto
+	if err := proto.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	// Piece types may be made explicit.
+	for _, p := range mp.Pieces {
+		p.Type = p.GetType().Enum()
+	}
+	if !proto.Equal(&got, mp) {
+		t.Errorf("written model proto differs from the original")
+	}
+}
@@ -0,0 +1,90 @@
+package sentencepiece
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"math"
+
+	"github.com/eliben/go-sentencepiece/internal/model"
+)
+
+// fingerprintVersion is hashed first in every fingerprint; it must be changed
+// whenever the data that goes into fingerprints changes.
+const fingerprintVersion = "go-sentencepiece fingerprint v2"
+
+// Fingerprint returns a hash that identifies the model's tokenization
+// behavior: two models with the same fingerprint encode and decode text
+// identically, so token IDs produced by one can be decoded by the other.
+//
+// The fingerprint covers the pieces of the model (their text, scores and
+// types, in ID order) and the settings of the normalizer, denormalizer and
+// trainer that affect encoding or decoding. Other fields of the model proto,
+// like the paths of the trainer's input files, are ignored. A model loaded
+// from the model proto and from its precompiled form have the same
+// fingerprint.
+//
+// The fingerprint is a hex-encoded SHA-256 hash. Hashing walks the whole
+// vocabulary, so only the first call pays for it.
+func (m *Model) Fingerprint() string {
+	m.fingerprintOnce.Do(func() {
+		h := sha256.New()
+		fw := fingerprintWriter{h: h}
+		fw.string(fingerprintVersion)
+
+		fw.uint64(uint64(m.numPieces()))
+		for id := range m.numPieces() {
+			fw.string(m.pieceString(id))
+			fw.uint64(uint64(math.Float32bits(m.pieceScores[id])))
+			fw.uint64(uint64(m.pieceTypes[id]))
+		}
+
+		ts := m.proto.GetTrainerSpec()
+		fw.uint64(uint64(ts.GetModelType()))
+		fw.bool(ts.GetByteFallback())
+		fw.string(ts.GetUnkSurface())
+		fw.bool(ts.GetTreatWhitespaceAsSuffix())
+		fw.bool(ts.GetAllowWhitespaceOnlyPieces())
+
+		fw.normalizerSpec(m.proto.GetNormalizerSpec())
+		fw.normalizerSpec(m.proto.GetDenormalizerSpec())
+
+		m.fingerprint = hex.EncodeToString(h.Sum(nil))
+	})
+	return m.fingerprint
+}
+
+// fingerprintWriter writes values to a hash in an unambiguous encoding.
+type fingerprintWriter struct {
+	h   hash.Hash
+	buf [8]byte
+}
+
+func (fw *fingerprintWriter) uint64(v uint64) {
+	binary.LittleEndian.PutUint64(fw.buf[:], v)
+	fw.h.Write(fw.buf[:])
+}
+
+func (fw *fingerprintWriter) bool(b bool) {
+	if b {
+		fw.uint64(1)
+	} else {
+		fw.uint64(0)
+	}
+}
+
+func (fw *fingerprintWriter) string(s string) {
+	fw.uint64(uint64(len(s)))
+	fw.h.Write([]byte(s))
+}
+
+// normalizerSpec writes the fields of ns that affect normalization; its name
+// doesn't, since the rules are in the precompiled charsmap.
+func (fw *fingerprintWriter) normalizerSpec(ns *model.NormalizerSpec) {
+	fw.string(string(ns.GetPrecompiledCharsmap()))
+	fw.bool(ns.GetAddDummyPrefix())
+	fw.bool(ns.GetRemoveExtraWhitespaces())
+	fw.bool(ns.GetEscapeWhitespaces())
+	fw.string(ns.GetNormalizationRuleTsv())
+}
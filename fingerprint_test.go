@@ -0,0 +1,95 @@
+package sentencepiece
+
+import (
+	"os"
+	"testing"
+
+	"github.com/eliben/go-sentencepiece/internal/charsmap"
+	"github.com/eliben/go-sentencepiece/internal/model"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFingerprint(t *testing.T) {
+	m, data := compileModel(t)
+	compiled, err := LoadModelFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fp := m.Fingerprint()
+	if len(fp) != 64 {
+		t.Errorf("got fingerprint %q, want 64 hex digits", fp)
+	}
+	if got := compiled.Fingerprint(); got != fp {
+		t.Errorf("compiled model: got fingerprint %s, want %s", got, fp)
+	}
+
+	protoData, err := os.ReadFile(modelPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name       string
+		modify     func(mp *model.ModelProto)
+		wantChange bool
+	}{
+		{"nothing", func(mp *model.ModelProto) {}, false},
+		{"trainer input", func(mp *model.ModelProto) {
+			mp.TrainerSpec.Input = []string{"/some/other/corpus.txt"}
+			mp.TrainerSpec.ModelPrefix = proto.String("other")
+		}, false},
+		{"explicit default", func(mp *model.ModelProto) {
+			mp.TrainerSpec.UnkSurface = proto.String(mp.GetTrainerSpec().GetUnkSurface())
+		}, false},
+		{"score", func(mp *model.ModelProto) {
+			mp.Pieces[len(mp.Pieces)-1].Score = proto.Float32(mp.Pieces[len(mp.Pieces)-1].GetScore() + 1)
+		}, true},
+		{"piece", func(mp *model.ModelProto) {
+			mp.Pieces[len(mp.Pieces)-1].Piece = proto.String("some new piece")
+		}, true},
+		{"type", func(mp *model.ModelProto) {
+			mp.Pieces[len(mp.Pieces)-1].Type = model.ModelProto_SentencePiece_UNUSED.Enum()
+		}, true},
+		{"order", func(mp *model.ModelProto) {
+			n := len(mp.Pieces)
+			mp.Pieces[n-1], mp.Pieces[n-2] = mp.Pieces[n-2], mp.Pieces[n-1]
+		}, true},
+		{"unk surface", func(mp *model.ModelProto) {
+			mp.TrainerSpec.UnkSurface = proto.String("<?>")
+		}, true},
+		{"whitespace-only pieces", func(mp *model.ModelProto) {
+			mp.TrainerSpec.AllowWhitespaceOnlyPieces = proto.Bool(!mp.GetTrainerSpec().GetAllowWhitespaceOnlyPieces())
+		}, true},
+		{"normalizer name", func(mp *model.ModelProto) {
+			mp.NormalizerSpec.Name = proto.String("some other name")
+		}, false},
+		{"normalizer rules", func(mp *model.ModelProto) {
+			precompiled, err := charsmap.Compile(map[string]string{"“": `"`})
+			if err != nil {
+				t.Fatal(err)
+			}
+			mp.NormalizerSpec.PrecompiledCharsmap = precompiled
+		}, true},
+		{"normalizer whitespace", func(mp *model.ModelProto) {
+			mp.NormalizerSpec.RemoveExtraWhitespaces = proto.Bool(!mp.GetNormalizerSpec().GetRemoveExtraWhitespaces())
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mp model.ModelProto
+			if err := proto.Unmarshal(protoData, &mp); err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(&mp)
+			modified, err := newModel(&mp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed := modified.Fingerprint() != fp; changed != tt.wantChange {
+				t.Errorf("got fingerprint change %v, want %v", changed, tt.wantChange)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package sentencepiece
+
+// HealTokens prepares the token IDs of a prompt for token healing. When a
+// prompt ends in the middle of a word (or URL, number, etc.), its last tokens
+// are cut at an unnatural boundary, which biases the model's continuation;
+// token healing removes these tokens and constrains the generated text to
+// begin with their text instead, letting the model choose the boundary.
+//
+// HealTokens removes up to maxTokens trailing tokens from ids (at least one,
+// if maxTokens < 1): the last token, and then each preceding token as long as
+// some token in the vocabulary begins with the text of all the tokens
+// removed. It doesn't remove control tokens or the unknown token.
+//
+// It returns the remaining IDs (a prefix of ids), the text of the removed
+// tokens, and the set of tokens that are compatible with that text: the first
+// generated token must be one of them. If the generated token's text is
+// shorter than the removed text, the next token must be compatible with the
+// rest of it, as found with [TokenTrie.Continuations], and so on. If no
+// tokens are removed, the text is empty and the set includes all tokens.
+//
+// The text is the tokens' surface, as defined by [TokenTrie]; it may end
+// with an incomplete UTF-8 sequence if the removed tokens include byte
+// tokens.
+func (proc *Processor) HealTokens(ids []int, maxTokens int) ([]int, string, IDSet) {
+	tt := proc.model.TokenTrie()
+	maxTokens = max(maxTokens, 1)
+
+	n := len(ids)
+	var prefix string
+	for removed := 0; removed < maxTokens && n > 0; removed++ {
+		surface, ok := tt.Surface(ids[n-1])
+		if !ok {
+			break
+		}
+		candidate := surface + prefix
+		if lo, hi := tt.prefixRange(candidate); lo == hi {
+			break
+		}
+		prefix = candidate
+		n--
+	}
+	return ids[:n:n], prefix, tt.Continuations(prefix)
+}
@@ -0,0 +1,57 @@
+package sentencepiece
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHealTokens(t *testing.T) {
+	proc := createProcessor(t)
+	tt := proc.Model().TokenTrie()
+
+	for _, text := range []string{"The url is http", "hello wor", "Bienvenido a este proyec", "x = 12345", "สวัสดี"} {
+		for _, maxTokens := range []int{0, 1, 3} {
+			var ids []int
+			for _, tok := range proc.Encode(text) {
+				ids = append(ids, tok.ID)
+			}
+			healed, prefix, allowed := proc.HealTokens(ids, maxTokens)
+
+			removed := len(ids) - len(healed)
+			if removed < 1 || removed > max(maxTokens, 1) {
+				t.Errorf("%q, %d: removed %d tokens", text, maxTokens, removed)
+			}
+			if !slices.Equal(healed, ids[:len(healed)]) {
+				t.Errorf("%q, %d: got %v, want a prefix of %v", text, maxTokens, healed, ids)
+			}
+			var sb strings.Builder
+			for _, id := range ids[len(healed):] {
+				surface, _ := tt.Surface(id)
+				sb.WriteString(surface)
+			}
+			if prefix != sb.String() {
+				t.Errorf("%q, %d: got prefix %q, want %q", text, maxTokens, prefix, sb.String())
+			}
+			if !slices.Equal(allowed.IDs(), tt.Continuations(prefix).IDs()) {
+				t.Errorf("%q, %d: allowed tokens aren't the continuations of %q", text, maxTokens, prefix)
+			}
+			if !allowed.Contains(ids[len(healed)]) {
+				t.Errorf("%q, %d: allowed tokens don't contain the first removed token", text, maxTokens)
+			}
+			if tt.WithPrefix(prefix).Len() == 0 {
+				t.Errorf("%q, %d: no token begins with %q", text, maxTokens, prefix)
+			}
+		}
+	}
+
+	// Control tokens aren't removed.
+	bos := proc.ModelInfo().BeginningOfSentenceID
+	healed, prefix, allowed := proc.HealTokens([]int{bos}, 1)
+	if !slices.Equal(healed, []int{bos}) || prefix != "" || allowed.Len() != tt.WithPrefix("").Len() {
+		t.Errorf("got %v, %q, %d tokens; want BOS kept, no prefix, all tokens", healed, prefix, allowed.Len())
+	}
+	if healed, prefix, _ := proc.HealTokens(nil, 1); len(healed) != 0 || prefix != "" {
+		t.Errorf("got %v, %q for no tokens", healed, prefix)
+	}
+}
@@ -0,0 +1,204 @@
+// Package charsmap implements SentencePiece's character maps: the
+// normalization rules of normalizer and denormalizer specs, which replace
+// substrings of text by other strings, preferring the longest match.
+//
+// Model protos store character maps in a "precompiled" form: a Darts-clone
+// double-array trie mapping the source strings to offsets into a blob of
+// NUL-terminated target strings. This package reads that form (see [New]),
+// and compiles rules to it (see [Compile]) like SentencePiece's trainer does.
+package charsmap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Map is a compiled character map. It's immutable, and safe for concurrent
+// use.
+type Map struct {
+	// units is the Darts-clone double array; see lookup for its format.
+	units []uint32
+
+	// normalized has the replacement strings, each terminated by a NUL byte.
+	normalized string
+}
+
+// New creates a Map from its precompiled form, as stored in the
+// precompiled_charsmap field of a normalizer spec: a little-endian uint32
+// with the size of the trie in bytes, the trie's units (little-endian
+// uint32s), and the replacement strings.
+func New(precompiled []byte) (*Map, error) {
+	if len(precompiled) < 4 {
+		return nil, errors.New("precompiled charsmap too short")
+	}
+	trieSize := uint64(binary.LittleEndian.Uint32(precompiled))
+	if trieSize%4 != 0 || trieSize > uint64(len(precompiled)-4) {
+		return nil, fmt.Errorf("bad trie size %d in precompiled charsmap", trieSize)
+	}
+	m := &Map{
+		units:      make([]uint32, trieSize/4),
+		normalized: string(precompiled[4+trieSize:]),
+	}
+	for i := range m.units {
+		m.units[i] = binary.LittleEndian.Uint32(precompiled[4+4*i:])
+	}
+	if len(m.units) == 0 {
+		return nil, errors.New("empty trie in precompiled charsmap")
+	}
+	return m, nil
+}
+
+// Darts-clone unit fields. A unit is either a node, with its label (the last
+// byte of its key), a flag telling if a key ends at the node, and the offset
+// of its children; or a value unit, which has the high bit set.
+func unitHasLeaf(u uint32) bool  { return (u>>8)&1 == 1 }
+func unitValue(u uint32) uint32  { return u & (1<<31 - 1) }
+func unitLabel(u uint32) uint32  { return u & (1<<31 | 0xFF) }
+func unitOffset(u uint32) uint32 { return (u >> 10) << ((u & (1 << 9)) >> 6) }
+
+// lookup finds the longest key that's a prefix of text, and returns its
+// length and replacement, and true; or false if there's no such key. Lookups
+// are range-checked, so a corrupt map can't cause a panic.
+func (m *Map) lookup(text string) (int, string, bool) {
+	var length int
+	var value uint32
+	found := false
+
+	pos := unitOffset(m.units[0])
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c == 0 {
+			// Keys can't contain NUL bytes, which end strings in C++.
+			break
+		}
+		pos ^= uint32(c)
+		if pos >= uint32(len(m.units)) || unitLabel(m.units[pos]) != uint32(c) {
+			break
+		}
+		unit := m.units[pos]
+		pos ^= unitOffset(unit)
+		if pos >= uint32(len(m.units)) {
+			break
+		}
+		if unitHasLeaf(unit) {
+			length, value, found = i+1, unitValue(m.units[pos]), true
+		}
+	}
+
+	if !found || value >= uint32(len(m.normalized)) {
+		return 0, "", false
+	}
+	replacement := m.normalized[value:]
+	if end := strings.IndexByte(replacement, 0); end >= 0 {
+		replacement = replacement[:end]
+	}
+	return length, replacement, true
+}
+
+// Normalize applies the map to text: starting at each position, it replaces
+// the longest key found there by its replacement, or if there's none, copies
+// the character there. Invalid UTF-8 is replaced by U+FFFD.
+func (m *Map) Normalize(text string) string {
+	normalized, _ := m.normalize(text, false)
+	return normalized
+}
+
+// NormalizeWithAlignment is like Normalize, but also returns the alignment of
+// the result to text: for each byte of the result, the offset in text of the
+// key (or character) it was produced from, followed by len(text). The
+// alignment is non-decreasing.
+func (m *Map) NormalizeWithAlignment(text string) (string, []int) {
+	return m.normalize(text, true)
+}
+
+func (m *Map) normalize(text string, align bool) (string, []int) {
+	var sb strings.Builder
+	sb.Grow(len(text))
+	var alignment []int
+
+	for i := 0; i < len(text); {
+		normalized, n := m.NormalizePrefix(text[i:])
+		sb.WriteString(normalized)
+		if align {
+			for range sb.Len() - len(alignment) {
+				alignment = append(alignment, i)
+			}
+		}
+		i += n
+	}
+	if align {
+		alignment = append(alignment, len(text))
+	}
+	return sb.String(), alignment
+}
+
+// NormalizePrefix normalizes the start of text, which must not be empty: if a
+// key is a prefix of text, it returns the replacement of the longest one and
+// its length; otherwise it returns the first character of text and its
+// length, with invalid UTF-8 replaced by U+FFFD.
+func (m *Map) NormalizePrefix(text string) (string, int) {
+	if n, replacement, ok := m.lookup(text); ok {
+		return replacement, n
+	}
+	r, size := utf8.DecodeRuneInString(text)
+	if r == utf8.RuneError && size == 1 {
+		return string(utf8.RuneError), 1
+	}
+	return text[:size], size
+}
+
+// ParseRules parses character map rules in the TSV format of SentencePiece's
+// normalization_rule_tsv: each line has a source and a target, separated by a
+// tab, where each is a sequence of Unicode code points written in hex and
+// separated by spaces (e.g. "FF21\t41"). Further tab-separated fields, text
+// after a "#", and empty lines are ignored. An empty target removes the
+// source from text.
+func ParseRules(tsv string) (map[string]string, error) {
+	rules := make(map[string]string)
+	for lineno, line := range strings.Split(tsv, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: want source and target separated by a tab", lineno+1)
+		}
+		source, err := parseCodepoints(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad source: %v", lineno+1, err)
+		}
+		if source == "" {
+			return nil, fmt.Errorf("line %d: empty source", lineno+1)
+		}
+		target, err := parseCodepoints(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad target: %v", lineno+1, err)
+		}
+		rules[source] = target
+	}
+	return rules, nil
+}
+
+// parseCodepoints parses a space-separated sequence of hex code points.
+func parseCodepoints(s string) (string, error) {
+	var sb strings.Builder
+	for _, f := range strings.Fields(s) {
+		cp, err := strconv.ParseUint(f, 16, 32)
+		if err != nil {
+			return "", err
+		}
+		if cp == 0 || cp > utf8.MaxRune || !utf8.ValidRune(rune(cp)) {
+			return "", fmt.Errorf("invalid code point %s", f)
+		}
+		sb.WriteRune(rune(cp))
+	}
+	return sb.String(), nil
+}
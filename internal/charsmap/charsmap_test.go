@@ -0,0 +1,143 @@
+package charsmap
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func compileMap(t *testing.T, rules map[string]string) *Map {
+	t.Helper()
+	precompiled, err := Compile(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(precompiled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestNormalize(t *testing.T) {
+	m := compileMap(t, map[string]string{
+		"“":   `"`,
+		"”":   `"`,
+		"—":   "--",
+		"ﬁ":   "fi",
+		"a":   "A",
+		"ab":  "X",
+		"abc": "Y",
+		"zz":  "",
+		"▁":   " ",
+	})
+
+	var tests = []struct {
+		text, want string
+	}{
+		{"", ""},
+		{"hello", "hello"},
+		{"“quoted”—ﬁne", `"quoted"--fine`},
+		{"a ab abc abcd", "A X Y Yd"},
+		{"zzz", "z"},
+		{"▁hello▁world", " hello world"},
+		{"bed \xff byte", "bed � byte"},
+		{"nul\x00a", "nul\x00A"},
+	}
+	for _, tt := range tests {
+		if got := m.Normalize(tt.text); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeWithAlignment(t *testing.T) {
+	m := compileMap(t, map[string]string{"ab": "X", "é": "e", "c": "ccc", "zz": ""})
+
+	got, alignment := m.NormalizeWithAlignment("abécdzzf")
+	if want := "Xeccc" + "df"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	wantAlignment := []int{0, 2, 4, 4, 4, 5, 8, 9}
+	if !slices.Equal(alignment, wantAlignment) {
+		t.Errorf("got alignment %v, want %v", alignment, wantAlignment)
+	}
+}
+
+func TestCompileRandom(t *testing.T) {
+	// Compile many random rules, and check that lookups find the longest
+	// matching source, like a naive search does.
+	rng := rand.New(rand.NewSource(1))
+	alphabet := []string{"a", "b", "c", "é", "世", "\x7f", "\xff"}
+	rules := make(map[string]string)
+	for range 2000 {
+		var sb strings.Builder
+		for range 1 + rng.Intn(6) {
+			sb.WriteString(alphabet[rng.Intn(len(alphabet))])
+		}
+		rules[sb.String()] = fmt.Sprint(rng.Intn(100))
+	}
+	m := compileMap(t, rules)
+
+	for range 2000 {
+		var sb strings.Builder
+		for range rng.Intn(10) {
+			sb.WriteString(alphabet[rng.Intn(len(alphabet))])
+		}
+		text := sb.String()
+
+		wantLen, wantRepl, wantOK := 0, "", false
+		for source, repl := range rules {
+			if strings.HasPrefix(text, source) && len(source) > wantLen {
+				wantLen, wantRepl, wantOK = len(source), repl, true
+			}
+		}
+		gotLen, gotRepl, gotOK := m.lookup(text)
+		if gotLen != wantLen || gotRepl != wantRepl || gotOK != wantOK {
+			t.Errorf("lookup(%q) = (%d, %q, %v), want (%d, %q, %v)", text, gotLen, gotRepl, gotOK, wantLen, wantRepl, wantOK)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for _, precompiled := range [][]byte{
+		nil,
+		{1, 0},
+		{5, 0, 0, 0, 1, 2, 3, 4, 5},
+		{16, 0, 0, 0, 1, 2, 3, 4},
+		{0, 0, 0, 0},
+	} {
+		if _, err := New(precompiled); err == nil {
+			t.Errorf("New(%v) succeeded, want error", precompiled)
+		}
+	}
+
+	// Corrupt units don't cause panics.
+	m := &Map{units: []uint32{0xFFFFFFFF, 0x12345678}, normalized: "x"}
+	m.Normalize("hello \xff world")
+}
+
+func TestParseRules(t *testing.T) {
+	tsv := "# comment line\n" +
+		"201C\t22\t# “ => \"\n" +
+		"FB01\t66 69\n" +
+		"\n" +
+		"41 300\tC0\r\n" +
+		"200B\t\n"
+	got, err := ParseRules(tsv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"“": `"`, "ﬁ": "fi", "À": "À", "​": ""}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"41", "4G\t41", "\t41", "41\t0", "41\t110000"} {
+		if _, err := ParseRules(bad); err == nil {
+			t.Errorf("ParseRules(%q) succeeded, want error", bad)
+		}
+	}
+}
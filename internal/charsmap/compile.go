@@ -0,0 +1,175 @@
+package charsmap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Compile compiles rules, which map source strings to their replacements, to
+// the precompiled form read by [New]. Sources must be non-empty, and can't
+// contain NUL bytes.
+//
+// The trie is built with a simple first-fit placement, so it's not
+// byte-for-byte identical to the one SentencePiece's trainer would build for
+// the same rules, but it has the same format and lookup results.
+func Compile(rules map[string]string) ([]byte, error) {
+	sources := make([]string, 0, len(rules))
+	for source := range rules {
+		if source == "" {
+			return nil, errors.New("empty source in rules")
+		}
+		if strings.IndexByte(source, 0) >= 0 {
+			return nil, fmt.Errorf("source %q contains a NUL byte", source)
+		}
+		sources = append(sources, source)
+	}
+	slices.Sort(sources)
+
+	// Lay out the replacement strings, sharing identical ones.
+	var normalized strings.Builder
+	offsets := make(map[string]uint32)
+	values := make([]uint32, len(sources))
+	for i, source := range sources {
+		replacement := rules[source]
+		if strings.IndexByte(replacement, 0) >= 0 {
+			return nil, fmt.Errorf("replacement of %q contains a NUL byte", source)
+		}
+		offset, ok := offsets[replacement]
+		if !ok {
+			offset = uint32(normalized.Len())
+			offsets[replacement] = offset
+			normalized.WriteString(replacement)
+			normalized.WriteByte(0)
+		}
+		values[i] = offset
+	}
+
+	b := &builder{}
+	b.build(sources, values)
+
+	precompiled := binary.LittleEndian.AppendUint32(nil, uint32(4*len(b.units)))
+	for _, u := range b.units {
+		precompiled = binary.LittleEndian.AppendUint32(precompiled, u)
+	}
+	return append(precompiled, normalized.String()...), nil
+}
+
+// builder builds a Darts-clone double array. The children of a node at
+// position p, whose unit has offset o, are at positions p^o^c for their labels
+// c; if a key ends at the node, its value unit is at p^o.
+//
+// Each node must have a distinct base p^o, so that a unit with label c at
+// base^c can only be the child of the node with that base; this is what makes
+// the label check in lookups sufficient.
+type builder struct {
+	units     []uint32
+	used      []bool
+	usedBases map[int]bool
+
+	// firstFree is a lower bound of the free positions, where the search for
+	// the offsets of new nodes starts.
+	firstFree int
+}
+
+func (b *builder) build(keys []string, values []uint32) {
+	b.usedBases = make(map[int]bool)
+	b.use(0)
+	b.place(0, keys, values, 0)
+}
+
+// use marks position pos as used, growing the array as needed.
+func (b *builder) use(pos int) {
+	for pos >= len(b.units) {
+		b.units = append(b.units, 0)
+		b.used = append(b.used, false)
+	}
+	b.used[pos] = true
+}
+
+func (b *builder) isFree(pos int) bool {
+	return pos >= len(b.used) || !b.used[pos]
+}
+
+// place places the children of the node at position pos, which is reached by
+// the first depth bytes of keys (sorted keys with this common prefix).
+func (b *builder) place(pos int, keys []string, values []uint32, depth int) {
+	// Find the labels of the children, and whether a key ends here.
+	var labels []byte
+	hasLeaf := false
+	for _, key := range keys {
+		if len(key) == depth {
+			hasLeaf = true
+		} else if c := key[depth]; len(labels) == 0 || labels[len(labels)-1] != c {
+			labels = append(labels, c)
+		}
+	}
+
+	// Find a base position whose slots for the value unit (base^0) and the
+	// children (base^c) are free, and whose offset from pos is encodable.
+	for b.firstFree < len(b.used) && b.used[b.firstFree] {
+		b.firstFree++
+	}
+	base := b.firstFree
+	for ; ; base++ {
+		offset := pos ^ base
+		if !encodableOffset(offset) || base == 0 || b.usedBases[base] {
+			continue
+		}
+		if hasLeaf && !b.isFree(base) {
+			continue
+		}
+		fits := true
+		for _, c := range labels {
+			if q := base ^ int(c); q == 0 || !b.isFree(q) {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			break
+		}
+	}
+
+	b.usedBases[base] = true
+	offset := uint32(pos ^ base)
+	if offset < 1<<21 {
+		b.units[pos] |= offset << 10
+	} else {
+		b.units[pos] |= (offset>>8)<<10 | 1<<9
+	}
+
+	i := 0
+	if hasLeaf {
+		b.use(base)
+		b.units[base] = values[0] | 1<<31
+		i = 1
+	}
+	for _, c := range labels {
+		b.use(base ^ int(c))
+	}
+	for _, c := range labels {
+		// keys[i:j] are the keys through the child with label c.
+		j := i
+		for j < len(keys) && keys[j][depth] == c {
+			j++
+		}
+		// The leaf flag of a node is in its own unit, and its value in the
+		// value unit at its base.
+		child := base ^ int(c)
+		b.units[child] |= uint32(c)
+		if len(keys[i]) == depth+1 {
+			b.units[child] |= 1 << 8
+		}
+		b.place(child, keys[i:j], values[i:j], depth+1)
+		i = j
+	}
+}
+
+// encodableOffset reports whether offset fits in a unit: either in 21 bits,
+// or in 29 bits with the low 8 bits zero.
+func encodableOffset(offset int) bool {
+	return offset < 1<<21 || (offset < 1<<29 && offset&0xFF == 0)
+}
@@ -0,0 +1,51 @@
+package main
+
+// Command compile converts a SentencePiece model proto into the precompiled
+// format of this package, which loads much faster; see
+// sentencepiece.Model.WriteCompiled.
+//
+// Usage:
+//
+//	compile <input model proto> <output file>
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/eliben/go-sentencepiece"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s <input model proto> <output file>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	m, err := sentencepiece.LoadModelFromPath(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	f, err := os.Create(flag.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	if err := m.WriteCompiled(w); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+// Command modeldiff shows the differences between two SentencePiece models:
+// their vocabularies and settings, and optionally how differently they
+// tokenize a sample corpus.
+//
+// Usage:
+//
+//	modeldiff [-corpus file]... [-max n] <old model> <new model>
+//
+// The models can be model protos or precompiled models. Each line of the
+// corpus files is encoded separately.
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/eliben/go-sentencepiece"
+)
+
+func main() {
+	var corpusFiles []string
+	flag.Func("corpus", "sample corpus file to compare tokenization on; may be repeated", func(s string) error {
+		corpusFiles = append(corpusFiles, s)
+		return nil
+	})
+	fMax := flag.Int("max", 20, "maximal number of pieces to show in each category; -1 for all")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: modeldiff [flags] <old model> <new model>\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	oldModel, err := sentencepiece.LoadModelFromPath(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	newModel, err := sentencepiece.LoadModelFromPath(flag.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	d := sentencepiece.DiffModels(oldModel, newModel)
+	if d.Empty() {
+		fmt.Println("models are identical")
+	}
+	if oldModel.Fingerprint() == newModel.Fingerprint() {
+		fmt.Println("models have the same fingerprint: tokenization is identical")
+	}
+
+	printPieces("added pieces", d.Added, *fMax)
+	printPieces("removed pieces", d.Removed, *fMax)
+	printChanges("renumbered pieces", d.Renumbered, *fMax, func(c sentencepiece.PieceChange) string {
+		return fmt.Sprintf("%q: %d -> %d", c.Old.Piece, c.Old.ID, c.New.ID)
+	})
+	printChanges("score changes", d.ScoreChanged, *fMax, func(c sentencepiece.PieceChange) string {
+		return fmt.Sprintf("%q: %g -> %g", c.Old.Piece, c.Old.Score, c.New.Score)
+	})
+	printChanges("type changes", d.TypeChanged, *fMax, func(c sentencepiece.PieceChange) string {
+		return fmt.Sprintf("%q: %s -> %s", c.Old.Piece, c.Old.Type, c.New.Type)
+	})
+	if len(d.SpecChanges) > 0 {
+		fmt.Printf("\nsettings changes (%d):\n", len(d.SpecChanges))
+		for _, c := range d.SpecChanges {
+			fmt.Printf("  %s: %s -> %s\n", c.Field, c.Old, c.New)
+		}
+	}
+
+	if len(corpusFiles) > 0 {
+		var lines []string
+		for _, path := range corpusFiles {
+			lines = append(lines, readLines(path)...)
+		}
+		td := sentencepiece.CompareTokenization(
+			sentencepiece.NewProcessorFromModel(oldModel),
+			sentencepiece.NewProcessorFromModel(newModel),
+			lines)
+
+		fmt.Printf("\ntokenization of %d lines:\n", td.Texts)
+		fmt.Printf("  changed lines: %d (%s)\n", td.ChangedTexts, percent(td.ChangedTexts, td.Texts))
+		fmt.Printf("  tokens: %d -> %d (%+d)\n", td.OldTokens, td.NewTokens, td.NewTokens-td.OldTokens)
+	}
+}
+
+func printPieces(title string, pieces []sentencepiece.PieceInfo, max int) {
+	printChanges(title, pieces, max, func(p sentencepiece.PieceInfo) string {
+		return fmt.Sprintf("%d: %q (score %g, %s)", p.ID, p.Piece, p.Score, p.Type)
+	})
+}
+
+func printChanges[T any](title string, items []T, max int, format func(T) string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Printf("\n%s (%d):\n", title, len(items))
+	for i, item := range items {
+		if max >= 0 && i >= max {
+			fmt.Printf("  ... and %d more\n", len(items)-max)
+			break
+		}
+		fmt.Printf("  %s\n", format(item))
+	}
+}
+
+func readLines(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+	return lines
+}
+
+func percent(n, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(total))
+}
@@ -0,0 +1,18 @@
+module github.com/eliben/go-sentencepiece/internal/cmd/tokgrpc
+
+go 1.22.5
+
+require (
+	github.com/eliben/go-sentencepiece v0.0.0-00010101000000-000000000000
+	google.golang.org/grpc v1.65.0
+	google.golang.org/protobuf v1.34.2
+)
+
+require (
+	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+	golang.org/x/text v0.15.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240528184218-531527333157 // indirect
+)
+
+replace github.com/eliben/go-sentencepiece => ../../..
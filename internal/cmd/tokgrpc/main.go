@@ -0,0 +1,104 @@
+package main
+
+// Command tokgrpc serves tokenization over gRPC; the service is defined in
+// tokenizerpb/tokenizer.proto.
+//
+// Usage:
+//
+//	tokgrpc -model gemma=/path/to/tokenizer.model [-model name=path ...]
+//
+// If no -model flag is given, the model at the path in the MODELPATH env var
+// is served with the name "default". The models can be model protos or
+// precompiled models (see internal/cmd/compile).
+//
+// This command is a separate module, so that the sentencepiece package
+// doesn't depend on gRPC.
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/eliben/go-sentencepiece"
+	pb "github.com/eliben/go-sentencepiece/internal/cmd/tokgrpc/tokenizerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func main() {
+	modelPaths := make(map[string]string)
+	flag.Func("model", "model to serve, as name=path; may be repeated", func(s string) error {
+		name, path, ok := strings.Cut(s, "=")
+		if !ok || name == "" || path == "" {
+			return errors.New("want name=path")
+		}
+		if _, ok := modelPaths[name]; ok {
+			return fmt.Errorf("duplicate model name %q", name)
+		}
+		modelPaths[name] = path
+		return nil
+	})
+	fAddr := flag.String("addr", "localhost:50051", "address to listen on")
+	fMaxMsg := flag.Int("maxmsg", 10<<20, "maximal size of a request message in bytes")
+	fMaxBatch := flag.Int("maxbatch", 1024, "maximal number of inputs in a request")
+	fMaxTokens := flag.Int("maxtokens", 0, "maximal number of tokens per encoded text; 0 for no limit")
+	fWordCache := flag.Int("wordcache", 100000, "size of the per-model word cache; 0 to disable")
+	flag.Parse()
+
+	if len(modelPaths) == 0 {
+		modelPath := os.Getenv("MODELPATH")
+		if modelPath == "" {
+			log.Fatal("Need -model flags or MODELPATH env var to run")
+		}
+		modelPaths["default"] = modelPath
+	}
+
+	models := make(map[string]*sentencepiece.Processor)
+	for name, path := range modelPaths {
+		proc, err := sentencepiece.NewProcessorFromPath(path,
+			sentencepiece.WithMaxTokens(*fMaxTokens),
+			sentencepiece.WithWordCache(*fWordCache))
+		if err != nil {
+			log.Fatalf("loading model %q: %v", name, err)
+		}
+		models[name] = proc
+		log.Printf("loaded model %q from %s", name, path)
+	}
+
+	lis, err := net.Listen("tcp", *fAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := grpc.NewServer(grpc.MaxRecvMsgSize(*fMaxMsg))
+	pb.RegisterTokenizerServer(srv, newServer(models, *fMaxBatch))
+	healthSrv := health.NewServer()
+	healthpb.RegisterHealthServer(srv, healthSrv)
+
+	// On a signal, stop accepting connections and wait for the RPCs in flight
+	// to finish.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		log.Print("shutting down")
+		healthSrv.Shutdown()
+		srv.GracefulStop()
+	}()
+
+	log.Printf("listening on %s", lis.Addr())
+	if err := srv.Serve(lis); err != nil {
+		log.Fatal(err)
+	}
+	<-shutdownDone
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/eliben/go-sentencepiece"
+	pb "github.com/eliben/go-sentencepiece/internal/cmd/tokgrpc/tokenizerpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// server implements the Tokenizer service for a set of named models.
+type server struct {
+	pb.UnimplementedTokenizerServer
+
+	models map[string]*sentencepiece.Processor
+
+	// maxBatch is the maximal number of inputs in a request.
+	maxBatch int
+}
+
+func newServer(models map[string]*sentencepiece.Processor, maxBatch int) *server {
+	return &server{models: models, maxBatch: maxBatch}
+}
+
+func (s *server) Encode(ctx context.Context, req *pb.EncodeRequest) (*pb.EncodeResponse, error) {
+	proc, err := s.processor(req.GetModel(), len(req.GetTexts()))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.EncodeResponse{Results: make([]*pb.EncodedText, len(req.GetTexts()))}
+	for i, text := range req.GetTexts() {
+		tokens, err := proc.EncodeContext(ctx, text)
+		if err != nil {
+			return nil, encodeError(err)
+		}
+		result := &pb.EncodedText{Ids: make([]int32, len(tokens)), Pieces: make([]string, len(tokens))}
+		for j, t := range tokens {
+			result.Ids[j] = int32(t.ID)
+			result.Pieces[j] = t.Text
+		}
+		resp.Results[i] = result
+	}
+	return resp, nil
+}
+
+func (s *server) CountTokens(ctx context.Context, req *pb.CountTokensRequest) (*pb.CountTokensResponse, error) {
+	proc, err := s.processor(req.GetModel(), len(req.GetTexts()))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.CountTokensResponse{Counts: make([]int32, len(req.GetTexts()))}
+	for i, text := range req.GetTexts() {
+		tokens, err := proc.EncodeContext(ctx, text)
+		if err != nil {
+			return nil, encodeError(err)
+		}
+		resp.Counts[i] = int32(len(tokens))
+	}
+	return resp, nil
+}
+
+func (s *server) Decode(ctx context.Context, req *pb.DecodeRequest) (*pb.DecodeResponse, error) {
+	proc, err := s.processor(req.GetModel(), len(req.GetInputs()))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.DecodeResponse{Texts: make([]string, len(req.GetInputs()))}
+	for i, input := range req.GetInputs() {
+		text, err := proc.DecodeWithOptions(toInts(input.GetIds()), sentencepiece.DecodeOptions{})
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		resp.Texts[i] = text
+	}
+	return resp, nil
+}
+
+func (s *server) StreamDecode(stream pb.Tokenizer_StreamDecodeServer) error {
+	var dec *sentencepiece.StreamDecoder
+	var proc *sentencepiece.Processor
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if dec == nil {
+			if proc, err = s.processor(req.GetModel(), 0); err != nil {
+				return err
+			}
+			dec = proc.NewStreamDecoder()
+		}
+
+		text, err := dec.Decode(toInts(req.GetIds()))
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		if err := stream.Send(&pb.StreamDecodeResponse{Text: text}); err != nil {
+			return err
+		}
+	}
+
+	if dec != nil {
+		if text := dec.Flush(); text != "" {
+			return stream.Send(&pb.StreamDecodeResponse{Text: text})
+		}
+	}
+	return nil
+}
+
+func (s *server) ListModels(ctx context.Context, req *pb.ListModelsRequest) (*pb.ListModelsResponse, error) {
+	resp := &pb.ListModelsResponse{}
+	for name, proc := range s.models {
+		info := proc.ModelInfo()
+		resp.Models = append(resp.Models, &pb.ModelInfo{
+			Name:                  name,
+			VocabularySize:        int32(info.VocabularySize),
+			BeginningOfSentenceId: int32(info.BeginningOfSentenceID),
+			EndOfSentenceId:       int32(info.EndOfSentenceID),
+			UnknownId:             int32(info.UnknownID),
+			PadId:                 int32(info.PadID),
+		})
+	}
+	sort.Slice(resp.Models, func(i, j int) bool { return resp.Models[i].Name < resp.Models[j].Name })
+	return resp, nil
+}
+
+// processor returns the processor for the named model, checking that a batch
+// of batchSize inputs is allowed.
+func (s *server) processor(name string, batchSize int) (*sentencepiece.Processor, error) {
+	if batchSize > s.maxBatch {
+		return nil, status.Errorf(codes.ResourceExhausted, "batch of %d inputs exceeds limit %d", batchSize, s.maxBatch)
+	}
+	if name == "" && len(s.models) == 1 {
+		for _, proc := range s.models {
+			return proc, nil
+		}
+	}
+	proc, ok := s.models[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown model %q", name)
+	}
+	return proc, nil
+}
+
+// toInts converts token IDs from their wire form.
+func toInts(ids []int32) []int {
+	result := make([]int, len(ids))
+	for i, id := range ids {
+		result[i] = int(id)
+	}
+	return result
+}
+
+// encodeError converts an error from EncodeContext to a gRPC status error.
+func encodeError(err error) error {
+	var limitErr *sentencepiece.LimitError
+	if errors.As(err, &limitErr) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return status.FromContextError(err).Err()
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/eliben/go-sentencepiece"
+	pb "github.com/eliben/go-sentencepiece/internal/cmd/tokgrpc/tokenizerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T) (pb.TokenizerClient, *sentencepiece.Processor) {
+	t.Helper()
+	modelPath := os.Getenv("MODELPATH")
+	if modelPath == "" {
+		t.Fatal("Need MODELPATH env var to run tests")
+	}
+	proc, err := sentencepiece.NewProcessorFromPath(modelPath, sentencepiece.WithMaxInputSize(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterTokenizerServer(srv, newServer(map[string]*sentencepiece.Processor{"default": proc}, 4))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewTokenizerClient(conn), proc
+}
+
+func TestEncodeDecode(t *testing.T) {
+	client, proc := newTestClient(t)
+	ctx := context.Background()
+	texts := []string{"hello world", "", "if allow == true { return x;}"}
+
+	encResp, err := client.Encode(ctx, &pb.EncodeRequest{Model: "default", Texts: texts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encResp.Results) != len(texts) {
+		t.Fatalf("got %d results, want %d", len(encResp.Results), len(texts))
+	}
+
+	var inputs []*pb.TokenIDs
+	for i, text := range texts {
+		var wantIDs []int32
+		var wantPieces []string
+		for _, tok := range proc.Encode(text) {
+			wantIDs = append(wantIDs, int32(tok.ID))
+			wantPieces = append(wantPieces, tok.Text)
+		}
+		got := encResp.Results[i]
+		if !slices.Equal(got.Ids, wantIDs) || !slices.Equal(got.Pieces, wantPieces) {
+			t.Errorf("encode %q: got %v, want ids %v pieces %v", text, got, wantIDs, wantPieces)
+		}
+		inputs = append(inputs, &pb.TokenIDs{Ids: got.Ids})
+	}
+
+	// The model name can be omitted, since there's a single model.
+	countResp, err := client.CountTokens(ctx, &pb.CountTokensRequest{Texts: texts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range texts {
+		if got, want := countResp.Counts[i], int32(len(inputs[i].Ids)); got != want {
+			t.Errorf("count %q: got %d, want %d", texts[i], got, want)
+		}
+	}
+
+	decResp, err := client.Decode(ctx, &pb.DecodeRequest{Inputs: inputs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(decResp.Texts, texts) {
+		t.Errorf("decode: got %q, want %q", decResp.Texts, texts)
+	}
+}
+
+func TestStreamDecode(t *testing.T) {
+	client, proc := newTestClient(t)
+	text := "hiƻ <td>🤨there ⇲bob, สวัสดี\nif allow == true { return x;}"
+
+	var ids []int32
+	for _, tok := range proc.Encode(text) {
+		ids = append(ids, int32(tok.ID))
+	}
+
+	stream, err := client.StreamDecode(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Send the IDs one at a time, as a model generating them would.
+	var sb strings.Builder
+	for i, id := range ids {
+		req := &pb.StreamDecodeRequest{Ids: []int32{id}}
+		if i == 0 {
+			req.Model = "default"
+		}
+		if err := stream.Send(req); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sb.WriteString(resp.Text)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			break
+		}
+		sb.WriteString(resp.Text)
+	}
+
+	if got := sb.String(); got != text {
+		t.Errorf("got %q, want %q", got, text)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	client, proc := newTestClient(t)
+	ctx := context.Background()
+	vocabSize := int32(proc.ModelInfo().VocabularySize)
+
+	var tests = []struct {
+		name     string
+		call     func() error
+		wantCode codes.Code
+	}{
+		{"unknown model", func() error {
+			_, err := client.Encode(ctx, &pb.EncodeRequest{Model: "nope", Texts: []string{"hi"}})
+			return err
+		}, codes.NotFound},
+		{"batch too large", func() error {
+			_, err := client.CountTokens(ctx, &pb.CountTokensRequest{Texts: []string{"a", "b", "c", "d", "e"}})
+			return err
+		}, codes.ResourceExhausted},
+		{"text too long", func() error {
+			_, err := client.Encode(ctx, &pb.EncodeRequest{Texts: []string{strings.Repeat("x", 1001)}})
+			return err
+		}, codes.ResourceExhausted},
+		{"bad ID", func() error {
+			_, err := client.Decode(ctx, &pb.DecodeRequest{Inputs: []*pb.TokenIDs{{Ids: []int32{vocabSize}}}})
+			return err
+		}, codes.InvalidArgument},
+		{"bad stream ID", func() error {
+			stream, err := client.StreamDecode(ctx)
+			if err != nil {
+				return err
+			}
+			if err := stream.Send(&pb.StreamDecodeRequest{Ids: []int32{-1}}); err != nil {
+				return err
+			}
+			_, err = stream.Recv()
+			return err
+		}, codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		if code := status.Code(tt.call()); code != tt.wantCode {
+			t.Errorf("%s: got code %v, want %v", tt.name, code, tt.wantCode)
+		}
+	}
+}
+
+func TestListModels(t *testing.T) {
+	client, proc := newTestClient(t)
+	resp, err := client.ListModels(context.Background(), &pb.ListModelsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := proc.ModelInfo()
+	if len(resp.Models) != 1 || resp.Models[0].Name != "default" || int(resp.Models[0].VocabularySize) != info.VocabularySize {
+		t.Errorf("got models %v", resp.Models)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+// Command tokserver serves tokenization over HTTP/JSON, for services that
+// can't use this package directly. See the server type for the API.
+//
+// Usage:
+//
+//	tokserver -model gemma=/path/to/tokenizer.model [-model name=path ...]
+//
+// If no -model flag is given, the model at the path in the MODELPATH env var
+// is served with the name "default". The models can be model protos or
+// precompiled models (see internal/cmd/compile).
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/eliben/go-sentencepiece"
+)
+
+func main() {
+	modelPaths := make(map[string]string)
+	flag.Func("model", "model to serve, as name=path; may be repeated", func(s string) error {
+		name, path, ok := strings.Cut(s, "=")
+		if !ok || name == "" || path == "" {
+			return errors.New("want name=path")
+		}
+		if _, ok := modelPaths[name]; ok {
+			return fmt.Errorf("duplicate model name %q", name)
+		}
+		modelPaths[name] = path
+		return nil
+	})
+	fAddr := flag.String("addr", "localhost:8080", "address to listen on")
+	fMaxBody := flag.Int64("maxbody", 10<<20, "maximal size of a request body in bytes")
+	fMaxBatch := flag.Int("maxbatch", 1024, "maximal number of inputs in a request")
+	fMaxTokens := flag.Int("maxtokens", 0, "maximal number of tokens per encoded text; 0 for no limit")
+	fWordCache := flag.Int("wordcache", 100000, "size of the per-model word cache; 0 to disable")
+	flag.Parse()
+
+	if len(modelPaths) == 0 {
+		modelPath := os.Getenv("MODELPATH")
+		if modelPath == "" {
+			log.Fatal("Need -model flags or MODELPATH env var to run")
+		}
+		modelPaths["default"] = modelPath
+	}
+
+	models := make(map[string]*sentencepiece.Processor)
+	for name, path := range modelPaths {
+		proc, err := sentencepiece.NewProcessorFromPath(path,
+			sentencepiece.WithMaxInputSize(int(*fMaxBody)),
+			sentencepiece.WithMaxTokens(*fMaxTokens),
+			sentencepiece.WithWordCache(*fWordCache))
+		if err != nil {
+			log.Fatalf("loading model %q: %v", name, err)
+		}
+		models[name] = proc
+		log.Printf("loaded model %q from %s", name, path)
+	}
+
+	srv := &http.Server{
+		Addr:              *fAddr,
+		Handler:           newServer(models, *fMaxBody, *fMaxBatch).handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// On a signal, stop accepting connections and wait for the requests in
+	// flight to finish.
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		log.Print("shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+	}()
+
+	log.Printf("listening on %s", *fAddr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-shutdownDone
+}
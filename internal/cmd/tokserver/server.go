@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/eliben/go-sentencepiece"
+)
+
+// server serves tokenization requests for a set of named models.
+//
+// All endpoints except the health check and model listing take a JSON request
+// with a "model" field naming the model to use; it may be omitted when the
+// server has a single model. Requests are batched: each request carries a list
+// of inputs, and the response has a result for each input, in order.
+//
+//	POST /v1/encode  {"texts": [...]}          -> {"results": [{"ids": [...], "pieces": [...]}]}
+//	POST /v1/count   {"texts": [...]}          -> {"counts": [...]}
+//	POST /v1/decode  {"ids": [[...]]}          -> {"texts": [...]}
+//	POST /v1/vocab   {"ids": [...], "pieces": [...]}
+//	                   -> {"pieces": [...], "ids": [...]}
+//	GET  /v1/models                            -> {"models": [{"name": ..., "info": {...}}]}
+//	GET  /healthz                              -> 200 OK
+//
+// In /v1/vocab, pieces that aren't in the vocabulary get ID -1, and IDs out
+// of range are an error. Errors are reported with a non-2xx status and a
+// body of {"error": "..."}.
+type server struct {
+	models map[string]*sentencepiece.Processor
+
+	// maxBodySize is the maximal size of a request body in bytes, and maxBatch
+	// the maximal number of inputs in a request.
+	maxBodySize int64
+	maxBatch    int
+}
+
+func newServer(models map[string]*sentencepiece.Processor, maxBodySize int64, maxBatch int) *server {
+	return &server{models: models, maxBodySize: maxBodySize, maxBatch: maxBatch}
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/encode", s.handleEncode)
+	mux.HandleFunc("POST /v1/count", s.handleCount)
+	mux.HandleFunc("POST /v1/decode", s.handleDecode)
+	mux.HandleFunc("POST /v1/vocab", s.handleVocab)
+	mux.HandleFunc("GET /v1/models", s.handleModels)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	return mux
+}
+
+// httpError is an error with the HTTP status code it should be reported with.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+func badRequest(format string, args ...any) error {
+	return &httpError{http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+type textsRequest struct {
+	Model string   `json:"model"`
+	Texts []string `json:"texts"`
+}
+
+type encodeResult struct {
+	IDs    []int    `json:"ids"`
+	Pieces []string `json:"pieces"`
+}
+
+func (s *server) handleEncode(w http.ResponseWriter, r *http.Request) {
+	var req textsRequest
+	proc, err := s.decodeRequest(w, r, &req, &req.Model)
+	if err == nil {
+		err = s.checkBatch(len(req.Texts))
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	results := make([]encodeResult, len(req.Texts))
+	for i, text := range req.Texts {
+		tokens, err := proc.EncodeContext(r.Context(), text)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		results[i] = encodeResult{IDs: make([]int, len(tokens)), Pieces: make([]string, len(tokens))}
+		for j, t := range tokens {
+			results[i].IDs[j] = t.ID
+			results[i].Pieces[j] = t.Text
+		}
+	}
+	writeJSON(w, map[string]any{"results": results})
+}
+
+func (s *server) handleCount(w http.ResponseWriter, r *http.Request) {
+	var req textsRequest
+	proc, err := s.decodeRequest(w, r, &req, &req.Model)
+	if err == nil {
+		err = s.checkBatch(len(req.Texts))
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	counts := make([]int, len(req.Texts))
+	for i, text := range req.Texts {
+		tokens, err := proc.EncodeContext(r.Context(), text)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		counts[i] = len(tokens)
+	}
+	writeJSON(w, map[string]any{"counts": counts})
+}
+
+func (s *server) handleDecode(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model string  `json:"model"`
+		IDs   [][]int `json:"ids"`
+	}
+	proc, err := s.decodeRequest(w, r, &req, &req.Model)
+	if err == nil {
+		err = s.checkBatch(len(req.IDs))
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	texts := make([]string, len(req.IDs))
+	for i, ids := range req.IDs {
+		if texts[i], err = proc.DecodeWithOptions(ids, sentencepiece.DecodeOptions{}); err != nil {
+			writeError(w, badRequest("%v", err))
+			return
+		}
+	}
+	writeJSON(w, map[string]any{"texts": texts})
+}
+
+func (s *server) handleVocab(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model  string   `json:"model"`
+		IDs    []int    `json:"ids"`
+		Pieces []string `json:"pieces"`
+	}
+	proc, err := s.decodeRequest(w, r, &req, &req.Model)
+	if err == nil {
+		err = s.checkBatch(len(req.IDs) + len(req.Pieces))
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	pieces := make([]string, len(req.IDs))
+	for i, id := range req.IDs {
+		piece, ok := proc.IDToPiece(id)
+		if !ok {
+			writeError(w, badRequest("token ID %d out of range", id))
+			return
+		}
+		pieces[i] = piece
+	}
+	ids := make([]int, len(req.Pieces))
+	for i, piece := range req.Pieces {
+		if id, ok := proc.PieceToID(piece); ok {
+			ids[i] = id
+		} else {
+			ids[i] = -1
+		}
+	}
+	writeJSON(w, map[string]any{"pieces": pieces, "ids": ids})
+}
+
+func (s *server) handleModels(w http.ResponseWriter, r *http.Request) {
+	type modelEntry struct {
+		Name string                   `json:"name"`
+		Info *sentencepiece.ModelInfo `json:"info"`
+	}
+	models := make([]modelEntry, 0, len(s.models))
+	for name, proc := range s.models {
+		models = append(models, modelEntry{Name: name, Info: proc.ModelInfo()})
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].Name < models[j].Name })
+	writeJSON(w, map[string]any{"models": models})
+}
+
+// decodeRequest decodes the JSON body of r into req, and returns the
+// processor for the model named by *modelName.
+func (s *server) decodeRequest(w http.ResponseWriter, r *http.Request, req any, modelName *string) (*sentencepiece.Processor, error) {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, &httpError{http.StatusRequestEntityTooLarge, fmt.Sprintf("request body larger than %d bytes", s.maxBodySize)}
+		}
+		return nil, badRequest("invalid request: %v", err)
+	}
+
+	if *modelName == "" && len(s.models) == 1 {
+		for _, proc := range s.models {
+			return proc, nil
+		}
+	}
+	proc, ok := s.models[*modelName]
+	if !ok {
+		return nil, &httpError{http.StatusNotFound, fmt.Sprintf("unknown model %q", *modelName)}
+	}
+	return proc, nil
+}
+
+func (s *server) checkBatch(n int) error {
+	if n > s.maxBatch {
+		return &httpError{http.StatusRequestEntityTooLarge, fmt.Sprintf("batch of %d inputs exceeds limit %d", n, s.maxBatch)}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var httpErr *httpError
+	var limitErr *sentencepiece.LimitError
+	switch {
+	case errors.As(err, &httpErr):
+		status = httpErr.status
+	case errors.As(err, &limitErr):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
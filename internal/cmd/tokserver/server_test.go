@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/eliben/go-sentencepiece"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, *sentencepiece.Processor) {
+	t.Helper()
+	modelPath := os.Getenv("MODELPATH")
+	if modelPath == "" {
+		t.Fatal("Need MODELPATH env var to run tests")
+	}
+	proc, err := sentencepiece.NewProcessorFromPath(modelPath, sentencepiece.WithMaxInputSize(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	models := map[string]*sentencepiece.Processor{"default": proc}
+	ts := httptest.NewServer(newServer(models, 4096, 4).handler())
+	t.Cleanup(ts.Close)
+	return ts, proc
+}
+
+// post sends req as JSON to path, decodes the response into resp and returns
+// the status code.
+func post(t *testing.T, ts *httptest.Server, path string, req any, resp any) int {
+	t.Helper()
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := http.Post(ts.URL+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+	return r.StatusCode
+}
+
+func TestEncodeDecode(t *testing.T) {
+	ts, proc := newTestServer(t)
+	texts := []string{"hello world", "", "if allow == true { return x;}"}
+
+	var encResp struct {
+		Results []encodeResult `json:"results"`
+	}
+	if code := post(t, ts, "/v1/encode", map[string]any{"model": "default", "texts": texts}, &encResp); code != http.StatusOK {
+		t.Fatalf("encode: got status %d", code)
+	}
+	if len(encResp.Results) != len(texts) {
+		t.Fatalf("encode: got %d results, want %d", len(encResp.Results), len(texts))
+	}
+
+	var allIDs [][]int
+	for i, text := range texts {
+		var wantIDs []int
+		var wantPieces []string
+		for _, tok := range proc.Encode(text) {
+			wantIDs = append(wantIDs, tok.ID)
+			wantPieces = append(wantPieces, tok.Text)
+		}
+		got := encResp.Results[i]
+		if !slices.Equal(got.IDs, wantIDs) || !slices.Equal(got.Pieces, wantPieces) {
+			t.Errorf("encode %q: got %v, want ids %v pieces %v", text, got, wantIDs, wantPieces)
+		}
+		allIDs = append(allIDs, got.IDs)
+	}
+
+	// The model name can be omitted, since there's a single model.
+	var countResp struct {
+		Counts []int `json:"counts"`
+	}
+	if code := post(t, ts, "/v1/count", map[string]any{"texts": texts}, &countResp); code != http.StatusOK {
+		t.Fatalf("count: got status %d", code)
+	}
+	for i := range texts {
+		if got, want := countResp.Counts[i], len(allIDs[i]); got != want {
+			t.Errorf("count %q: got %d, want %d", texts[i], got, want)
+		}
+	}
+
+	var decResp struct {
+		Texts []string `json:"texts"`
+	}
+	if code := post(t, ts, "/v1/decode", map[string]any{"ids": allIDs}, &decResp); code != http.StatusOK {
+		t.Fatalf("decode: got status %d", code)
+	}
+	if !slices.Equal(decResp.Texts, texts) {
+		t.Errorf("decode: got %q, want %q", decResp.Texts, texts)
+	}
+}
+
+func TestVocab(t *testing.T) {
+	ts, proc := newTestServer(t)
+	ids := []int{0, 1, proc.ModelInfo().VocabularySize - 1}
+
+	var resp struct {
+		Pieces []string `json:"pieces"`
+		IDs    []int    `json:"ids"`
+	}
+	if code := post(t, ts, "/v1/vocab", map[string]any{"ids": ids}, &resp); code != http.StatusOK {
+		t.Fatalf("got status %d", code)
+	}
+
+	pieces := append(slices.Clone(resp.Pieces), "no such piece")
+	if code := post(t, ts, "/v1/vocab", map[string]any{"pieces": pieces}, &resp); code != http.StatusOK {
+		t.Fatalf("got status %d", code)
+	}
+	wantIDs := append(slices.Clone(ids), -1)
+	if !slices.Equal(resp.IDs, wantIDs) {
+		t.Errorf("got ids %v, want %v", resp.IDs, wantIDs)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ts, proc := newTestServer(t)
+	vocabSize := proc.ModelInfo().VocabularySize
+
+	var tests = []struct {
+		path       string
+		req        any
+		wantStatus int
+	}{
+		{"/v1/encode", map[string]any{"model": "nope", "texts": []string{"hi"}}, http.StatusNotFound},
+		{"/v1/encode", map[string]any{"texts": []string{"a", "b", "c", "d", "e"}}, http.StatusRequestEntityTooLarge},
+		{"/v1/encode", map[string]any{"texts": []string{strings.Repeat("x", 5000)}}, http.StatusRequestEntityTooLarge},
+		{"/v1/count", map[string]any{"texts": []string{strings.Repeat("x", 1001)}}, http.StatusRequestEntityTooLarge},
+		{"/v1/encode", map[string]any{"txts": []string{"hi"}}, http.StatusBadRequest},
+		{"/v1/decode", map[string]any{"ids": [][]int{{vocabSize}}}, http.StatusBadRequest},
+		{"/v1/decode", map[string]any{"ids": [][]int{{-1}}}, http.StatusBadRequest},
+		{"/v1/vocab", map[string]any{"ids": []int{vocabSize}}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		var resp struct {
+			Error string `json:"error"`
+		}
+		if code := post(t, ts, tt.path, tt.req, &resp); code != tt.wantStatus {
+			t.Errorf("%s %v: got status %d, want %d", tt.path, tt.req, code, tt.wantStatus)
+		}
+		if resp.Error == "" {
+			t.Errorf("%s %v: got empty error message", tt.path, tt.req)
+		}
+	}
+}
+
+func TestHealthAndModels(t *testing.T) {
+	ts, proc := newTestServer(t)
+
+	r, err := http.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		t.Errorf("healthz: got status %d", r.StatusCode)
+	}
+
+	r, err = http.Get(ts.URL + "/v1/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	var resp struct {
+		Models []struct {
+			Name string                  `json:"name"`
+			Info sentencepiece.ModelInfo `json:"info"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Models) != 1 || resp.Models[0].Name != "default" || resp.Models[0].Info != *proc.ModelInfo() {
+		t.Errorf("got models %+v", resp.Models)
+	}
+}
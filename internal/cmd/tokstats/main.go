@@ -0,0 +1,183 @@
+package main
+
+// Command tokstats writes a report of how SentencePiece models tokenize a set
+// of corpus files, for comparing tokenizers: their fertility (tokens per word
+// and per character), byte-fallback and unknown token rates, and piece
+// frequencies.
+//
+// Usage:
+//
+//	tokstats -model file [-model file]... [flags] [label=]corpus...
+//
+// Each corpus file is reported separately, unless files are given the same
+// label (e.g. their language), in which case their statistics are combined:
+//
+//	tokstats -model tokenizer.model en=test/pg7193_english.txt \
+//	  en=test/romeo-juliet-english.txt es=test/pg2000_spanish.txt
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/eliben/go-sentencepiece"
+	"github.com/eliben/go-sentencepiece/analytics"
+)
+
+func main() {
+	var modelPaths []string
+	flag.Func("model", "model file to analyze; may be repeated", func(s string) error {
+		modelPaths = append(modelPaths, s)
+		return nil
+	})
+	fTop := flag.Int("top", 0, "show the n most frequent pieces of each corpus")
+	fHist := flag.Bool("hist", false, "show the piece frequency histogram of each corpus")
+	fJSON := flag.Bool("json", false, "write the report as JSON")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: tokstats -model file [-model file]... [flags] [label=]corpus...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if len(modelPaths) == 0 || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Group the corpus files by label, keeping the order of the arguments.
+	var labels []string
+	files := make(map[string][]string)
+	for _, arg := range flag.Args() {
+		label, path, ok := strings.Cut(arg, "=")
+		if !ok {
+			label, path = arg, arg
+		}
+		if _, seen := files[label]; !seen {
+			labels = append(labels, label)
+		}
+		files[label] = append(files[label], path)
+	}
+
+	var reports []modelReport
+	for _, modelPath := range modelPaths {
+		proc, err := sentencepiece.NewProcessorFromPath(modelPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		report := modelReport{Model: modelPath}
+		for _, label := range labels {
+			a := analytics.NewAnalyzer(proc, label)
+			for _, path := range files[label] {
+				f, err := os.Open(path)
+				if err != nil {
+					log.Fatal(err)
+				}
+				if err := a.AddReader(f); err != nil {
+					log.Fatalf("%s: %v", path, err)
+				}
+				f.Close()
+			}
+			report.Corpora = append(report.Corpora, newCorpusReport(a.Stats(), proc, *fTop))
+		}
+		reports = append(reports, report)
+	}
+
+	if *fJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	for i, report := range reports {
+		if i > 0 {
+			fmt.Println()
+		}
+		report.print(*fTop, *fHist)
+	}
+}
+
+type modelReport struct {
+	Model   string         `json:"model"`
+	Corpora []corpusReport `json:"corpora"`
+}
+
+type corpusReport struct {
+	Name               string                      `json:"name"`
+	Lines              int                         `json:"lines"`
+	Words              int                         `json:"words"`
+	Chars              int                         `json:"chars"`
+	Bytes              int                         `json:"bytes"`
+	Tokens             int                         `json:"tokens"`
+	TokensPerWord      float64                     `json:"tokens_per_word"`
+	TokensPerChar      float64                     `json:"tokens_per_char"`
+	BytesPerToken      float64                     `json:"bytes_per_token"`
+	ByteFallbackRate   float64                     `json:"byte_fallback_rate"`
+	UnknownRate        float64                     `json:"unknown_rate"`
+	VocabularyCoverage float64                     `json:"vocabulary_coverage"`
+	Histogram          []analytics.HistogramBucket `json:"histogram"`
+	TopPieces          []pieceReport               `json:"top_pieces,omitempty"`
+}
+
+type pieceReport struct {
+	ID    int    `json:"id"`
+	Piece string `json:"piece"`
+	Count int    `json:"count"`
+}
+
+func newCorpusReport(s *analytics.Stats, proc *sentencepiece.Processor, top int) corpusReport {
+	r := corpusReport{
+		Name:               s.Name,
+		Lines:              s.Lines,
+		Words:              s.Words,
+		Chars:              s.Chars,
+		Bytes:              s.Bytes,
+		Tokens:             s.Tokens,
+		TokensPerWord:      s.TokensPerWord(),
+		TokensPerChar:      s.TokensPerChar(),
+		BytesPerToken:      s.BytesPerToken(),
+		ByteFallbackRate:   s.ByteFallbackRate(),
+		UnknownRate:        s.UnknownRate(),
+		VocabularyCoverage: s.VocabularyCoverage(),
+		Histogram:          s.Histogram(),
+	}
+	if top > 0 {
+		for _, pc := range s.TopPieces(top) {
+			piece, _ := proc.IDToPiece(pc.ID)
+			r.TopPieces = append(r.TopPieces, pieceReport{ID: pc.ID, Piece: piece, Count: pc.Count})
+		}
+	}
+	return r
+}
+
+func (report *modelReport) print(top int, hist bool) {
+	fmt.Printf("model: %s\n\n", report.Model)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "corpus\twords\tchars\ttokens\ttok/word\ttok/char\tbytes/tok\tbyte fallback\tunknown\tvocab used\t")
+	for _, c := range report.Corpora {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.3f\t%.3f\t%.2f\t%.2f%%\t%.2f%%\t%.1f%%\t\n",
+			c.Name, c.Words, c.Chars, c.Tokens, c.TokensPerWord, c.TokensPerChar, c.BytesPerToken,
+			100*c.ByteFallbackRate, 100*c.UnknownRate, 100*c.VocabularyCoverage)
+	}
+	tw.Flush()
+
+	for _, c := range report.Corpora {
+		if hist {
+			fmt.Printf("\npiece frequencies in %s:\n", c.Name)
+			for _, b := range c.Histogram {
+				fmt.Printf("  %8d-%-8d %d\n", b.Min, b.Max, b.Pieces)
+			}
+		}
+		if top > 0 {
+			fmt.Printf("\ntop pieces in %s:\n", c.Name)
+			for _, p := range c.TopPieces {
+				fmt.Printf("  %6d  %-20q %d\n", p.ID, p.Piece, p.Count)
+			}
+		}
+	}
+}
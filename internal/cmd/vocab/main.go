@@ -0,0 +1,118 @@
+package main
+
+// Command vocab exports the vocabulary of a SentencePiece model, and builds
+// model protos from exported vocabularies.
+//
+// Usage:
+//
+//	vocab export [-format tsv|json] [-settings file] <model>
+//	vocab import [-format tsv|json] -settings file <vocab file> <output model>
+//
+// export writes the vocabulary of the model to stdout; with -settings, it
+// also writes the model's settings (trainer spec, normalizer spec, etc.) to
+// the given file, in protobuf text format. import builds a model proto from
+// a vocabulary and such a settings file. See sentencepiece.VocabTSV for the
+// TSV format, which is compatible with the output of spm_export_vocab.
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/eliben/go-sentencepiece"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	fFormat := fs.String("format", "tsv", "vocabulary format: tsv or json")
+	fSettings := fs.String("settings", "", "model settings file")
+	fs.Parse(os.Args[2:])
+
+	var format sentencepiece.VocabFormat
+	switch *fFormat {
+	case "tsv":
+		format = sentencepiece.VocabTSV
+	case "json":
+		format = sentencepiece.VocabJSON
+	default:
+		log.Fatalf("unknown format %q", *fFormat)
+	}
+
+	switch os.Args[1] {
+	case "export":
+		if fs.NArg() != 1 {
+			usage()
+		}
+		exportVocab(fs.Arg(0), format, *fSettings)
+	case "import":
+		if fs.NArg() != 2 || *fSettings == "" {
+			usage()
+		}
+		importVocab(fs.Arg(0), fs.Arg(1), format, *fSettings)
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: vocab export [-format tsv|json] [-settings file] <model>")
+	fmt.Fprintln(os.Stderr, "       vocab import [-format tsv|json] -settings file <vocab file> <output model>")
+	os.Exit(2)
+}
+
+func exportVocab(modelPath string, format sentencepiece.VocabFormat, settingsPath string) {
+	m, err := sentencepiece.LoadModelFromPath(modelPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := m.WriteVocab(os.Stdout, format); err != nil {
+		log.Fatal(err)
+	}
+
+	if settingsPath != "" {
+		f, err := os.Create(settingsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := m.WriteSettings(f); err != nil {
+			log.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func importVocab(vocabPath, outPath string, format sentencepiece.VocabFormat, settingsPath string) {
+	f, err := os.Open(vocabPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	vocab, err := sentencepiece.ReadVocab(f, format)
+	if err != nil {
+		log.Fatalf("%s: %v", vocabPath, err)
+	}
+
+	settings, err := os.ReadFile(settingsPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, err := sentencepiece.BuildModelProto(vocab, settings)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Check that the model is usable before writing it.
+	if _, err := sentencepiece.LoadModelFromBytes(data); err != nil {
+		log.Fatalf("built model is invalid: %v", err)
+	}
+	if err := os.WriteFile(outPath, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -9,22 +9,24 @@ import (
 	_ "embed"
 	"fmt"
 	"log"
-	"strings"
 	"sync"
 	"syscall/js"
 
 	"github.com/eliben/go-sentencepiece"
 )
 
+// The model proto is embedded rather than its precompiled form (see
+// sentencepiece.Model.WriteCompiled), which loads faster but is larger.
+//
 //go:embed embed_data/tokenizer.model
-var modelFileData string
+var modelFileData []byte
 var spm *sentencepiece.Processor
 
 func main() {
 	var once sync.Once
 	once.Do(func() {
 		var err error
-		spm, err = sentencepiece.NewProcessor(strings.NewReader(modelFileData))
+		spm, err = sentencepiece.NewProcessorFromBytes(modelFileData)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -0,0 +1,346 @@
+// Package doublearray implements a double-array trie: a compact and
+// cache-friendly trie representation that maps byte strings to integer values,
+// similar to the Darts library used by the C++ SentencePiece implementation.
+//
+// The trie is stored in a single flat array of 4-byte units, packed like in
+// Darts-clone: every node is a unit holding its label (the last byte of its
+// key), a flag telling if a key ends at the node, and the XOR offset of its
+// children. The child of node n for byte c is at unit base(n)^(c+1), if that
+// unit's label is c; a key that ends at node n has its value in a value unit
+// at base(n), which has the high bit set. Every node has a distinct base, so
+// the label check is enough to tell a node's children from other units.
+//
+// Unlike in Darts, keys can contain NUL bytes: children are placed at
+// base^(c+1) rather than base^c, so that they don't clash with value units.
+package doublearray
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// Trie is an immutable double-array trie mapping byte strings to
+// non-negative values.
+type Trie struct {
+	// units has the node units and value units of the trie; see the package
+	// comment and the unit* functions for their format.
+	units []uint32
+}
+
+// Node is the index of a node in the trie, used to traverse it incrementally
+// with [Trie.Child]. The root node is [Root].
+type Node int32
+
+// Root is the root node of every trie.
+const Root Node = 0
+
+// Unit fields. A node unit has the node's label in bits 0-7, its leaf flag in
+// bit 8, and the offset of its children in bits 10-30; if bit 9 is set, the
+// offset is shifted left by 8 bits. A value unit (or an unused one) has bit 31
+// set, so its label never matches a byte, and holds the value in bits 0-30.
+const (
+	leafBit      = 1 << 8
+	extensionBit = 1 << 9
+	valueBit     = 1 << 31
+)
+
+func unitHasLeaf(u uint32) bool  { return u&leafBit != 0 }
+func unitLabel(u uint32) uint32  { return u & (valueBit | 0xFF) }
+func unitOffset(u uint32) uint32 { return (u >> 10) << ((u & extensionBit) >> 6) }
+
+// encodeOffset returns offset encoded in bits 9-30 of a node unit, and true;
+// or false if offset can't be encoded.
+func encodeOffset(offset int) (uint32, bool) {
+	if offset < 1<<21 {
+		return uint32(offset) << 10, true
+	}
+	if offset < 1<<29 && offset&0xFF == 0 {
+		return uint32(offset>>8)<<10 | extensionBit, true
+	}
+	return 0, false
+}
+
+// New builds a trie mapping keys[i] to values[i]. Values must be
+// non-negative and below 2^31. If a key appears several times, the last value
+// wins.
+func New(keys []string, values []int) *Trie {
+	if len(keys) != len(values) {
+		panic("doublearray: keys and values have different lengths")
+	}
+
+	// Sort the entries by key, and then by index so that the last duplicate
+	// can be picked.
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int {
+		if c := strings.Compare(keys[a], keys[b]); c != 0 {
+			return c
+		}
+		return a - b
+	})
+
+	var sortedKeys []string
+	var sortedValues []int32
+	for i, idx := range order {
+		if values[idx] < 0 || values[idx] >= valueBit {
+			panic("doublearray: value out of range")
+		}
+		if i+1 < len(order) && keys[order[i+1]] == keys[idx] {
+			continue
+		}
+		sortedKeys = append(sortedKeys, keys[idx])
+		sortedValues = append(sortedValues, int32(values[idx]))
+	}
+
+	b := newBuilder(len(sortedKeys))
+	if len(sortedKeys) > 0 {
+		b.build(sortedKeys, sortedValues, 0, Root)
+	}
+	return &Trie{units: b.finish()}
+}
+
+// Units returns the underlying representation of the trie, which can be
+// stored and later used to recreate it with [FromUnits].
+func (t *Trie) Units() []uint32 {
+	return t.units
+}
+
+// FromUnits creates a trie from the representation returned by
+// [Trie.Units]. units is used directly, without copying. Lookups in a trie
+// created from corrupt units may return wrong results, but won't panic.
+func FromUnits(units []uint32) (*Trie, error) {
+	if len(units) == 0 {
+		return nil, errors.New("doublearray: invalid units")
+	}
+	return &Trie{units: units}, nil
+}
+
+// Child returns the child of node n for byte c, and true; or false if n has
+// no such child.
+func (t *Trie) Child(n Node, c byte) (Node, bool) {
+	next := uint32(n) ^ unitOffset(t.units[n]) ^ (uint32(c) + 1)
+	if next >= uint32(len(t.units)) || unitLabel(t.units[next]) != uint32(c) {
+		return 0, false
+	}
+	return Node(next), true
+}
+
+// Value returns the value of the key that ends at node n, and true; or false
+// if no key ends at n.
+func (t *Trie) Value(n Node) (int, bool) {
+	u := t.units[n]
+	if !unitHasLeaf(u) {
+		return 0, false
+	}
+	pos := uint32(n) ^ unitOffset(u)
+	if pos >= uint32(len(t.units)) || t.units[pos]&valueBit == 0 {
+		return 0, false
+	}
+	return int(t.units[pos] &^ valueBit), true
+}
+
+// Walk traverses the bytes of s starting at node n, and returns the node
+// reached and true; or false if the trie has no such path.
+func (t *Trie) Walk(n Node, s string) (Node, bool) {
+	for i := 0; i < len(s); i++ {
+		var ok bool
+		if n, ok = t.Child(n, s[i]); !ok {
+			return 0, false
+		}
+	}
+	return n, true
+}
+
+// Lookup returns the value for key, and true; or false if key is not in
+// the trie.
+func (t *Trie) Lookup(key string) (int, bool) {
+	n, ok := t.Walk(Root, key)
+	if !ok {
+		return 0, false
+	}
+	return t.Value(n)
+}
+
+// LongestPrefix finds the longest key that's a prefix of text, and returns
+// its length and value. If no key is a prefix of text, it returns length 0.
+func (t *Trie) LongestPrefix(text string) (int, int) {
+	n := Root
+	length, value := 0, 0
+	for i := 0; i < len(text); i++ {
+		var ok bool
+		if n, ok = t.Child(n, text[i]); !ok {
+			break
+		}
+		if v, ok := t.Value(n); ok {
+			length, value = i+1, v
+		}
+	}
+	return length, value
+}
+
+// builder constructs the units of a trie. Unused units are kept in a
+// doubly-linked free list so that the search for a base offset only visits
+// free units.
+type builder struct {
+	units []uint32
+
+	// usedBase[i] is true if i is the base of a node.
+	usedBase []bool
+
+	// nextFree and prevFree link the unused units in a circular list; used
+	// units have -1 in both. The list head is unit 0: it's the root, which is
+	// never free, so it serves as a sentinel.
+	nextFree, prevFree []int32
+
+	// end is one past the highest unit used so far.
+	end int
+}
+
+func newBuilder(numKeys int) *builder {
+	b := &builder{}
+	b.grow(max(512, 2*numKeys))
+	b.units[0] = 0
+	return b
+}
+
+// grow extends the arrays to hold at least n units, adding the new units to
+// the free list.
+func (b *builder) grow(n int) {
+	old := len(b.units)
+	if n <= old {
+		return
+	}
+	n = max(n, 2*old)
+	b.units = slices.Grow(b.units, n-old)[:n]
+	b.usedBase = slices.Grow(b.usedBase, n-old)[:n]
+	b.nextFree = slices.Grow(b.nextFree, n-old)[:n]
+	b.prevFree = slices.Grow(b.prevFree, n-old)[:n]
+
+	for i := old; i < n; i++ {
+		b.units[i] = valueBit
+		b.usedBase[i] = false
+		b.nextFree[i] = int32(i + 1)
+		b.prevFree[i] = int32(i - 1)
+	}
+
+	if old == 0 {
+		// Unit 0 is the sentinel: close the circle through it.
+		b.prevFree[0] = int32(n - 1)
+		b.nextFree[n-1] = 0
+		return
+	}
+	last := b.prevFree[0]
+	b.nextFree[last] = int32(old)
+	b.prevFree[old] = last
+	b.nextFree[n-1] = 0
+	b.prevFree[0] = int32(n - 1)
+}
+
+// use marks unit i as used, removing it from the free list.
+func (b *builder) use(i int) {
+	b.close(i)
+	b.end = max(b.end, i+1)
+}
+
+// close removes unit i from the free list, leaving it unused.
+func (b *builder) close(i int) {
+	next, prev := b.nextFree[i], b.prevFree[i]
+	b.nextFree[prev] = next
+	b.prevFree[next] = prev
+	b.nextFree[i], b.prevFree[i] = -1, -1
+}
+
+func (b *builder) isFree(i int) bool {
+	return b.nextFree[i] >= 0 && i != 0
+}
+
+// build adds keys (sorted, unique, and sharing a prefix of length depth)
+// below node.
+func (b *builder) build(keys []string, values []int32, depth int, node Node) {
+	// Collect the distinct labels of node's children; label 0 is the value
+	// unit, and byte c has label c+1. Since keys are sorted, the labels are
+	// sorted too.
+	var labels []int
+	var starts []int
+	for i, key := range keys {
+		label := 0
+		if len(key) > depth {
+			label = int(key[depth]) + 1
+		}
+		if len(labels) == 0 || labels[len(labels)-1] != label {
+			labels = append(labels, label)
+			starts = append(starts, i)
+		}
+	}
+	starts = append(starts, len(keys))
+
+	base := b.findBase(int(node), labels)
+	offset, _ := encodeOffset(int(node) ^ base)
+	b.units[node] |= offset
+	b.usedBase[base] = true
+	for _, label := range labels {
+		b.use(base ^ label)
+	}
+
+	for i, label := range labels {
+		if label == 0 {
+			b.units[node] |= leafBit
+			b.units[base] = valueBit | uint32(values[starts[i]])
+		} else {
+			child := base ^ label
+			b.units[child] = uint32(label - 1)
+			b.build(keys[starts[i]:starts[i+1]], values[starts[i]:starts[i+1]], depth+1, Node(child))
+		}
+	}
+}
+
+// searchWindow is the number of units at the end of the array where findBase
+// looks for free units.
+const searchWindow = 4096
+
+// findBase finds a base for node's children: a base that's not the base of
+// another node, whose offset from node can be encoded, and such that
+// base^label is a free unit for all the given labels. It grows the arrays if
+// needed.
+func (b *builder) findBase(node int, labels []int) int {
+	// Like Darts, give up on free units far behind the used ones (the list is
+	// in index order): they're mostly holes that no base fits, and skipping
+	// them keeps the search short.
+	for free := int(b.nextFree[0]); free != 0 && free < b.end-searchWindow; free = int(b.nextFree[0]) {
+		b.close(free)
+	}
+
+	for {
+		for free := int(b.nextFree[0]); free != 0; free = int(b.nextFree[free]) {
+			base := free ^ labels[0]
+			// Labels are at most 256, so base^label is below base|511.
+			b.grow((base | 511) + 1)
+			if b.usedBase[base] {
+				continue
+			}
+			if _, ok := encodeOffset(node ^ base); !ok {
+				continue
+			}
+			ok := true
+			for _, label := range labels[1:] {
+				if !b.isFree(base ^ label) {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				return base
+			}
+		}
+		// No room in the existing units; grow and try again.
+		b.grow(len(b.units) + 512)
+	}
+}
+
+// finish returns the units, trimming unused units at the end.
+func (b *builder) finish() []uint32 {
+	return slices.Clip(b.units[:max(b.end, 1)])
+}
@@ -0,0 +1,362 @@
+package doublearray
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	keys := []string{"ham", "hamat", "hamela", "yefet", "世界", "▁▁", "▁▁▁", "a", "ab", "abc", "\x00", "\xff\xfe"}
+	values := make([]int, len(keys))
+	for i := range keys {
+		values[i] = i * 10
+	}
+	trie := New(keys, values)
+
+	for i, key := range keys {
+		v, ok := trie.Lookup(key)
+		if !ok || v != values[i] {
+			t.Errorf("Lookup(%q) = (%v, %v), want (%v, true)", key, v, ok, values[i])
+		}
+	}
+
+	for _, key := range []string{"", "h", "ha", "hama", "hamelax", "世", "▁", "b", "abcd", "\xff"} {
+		if v, ok := trie.Lookup(key); ok {
+			t.Errorf("Lookup(%q) = (%v, %v), want not found", key, v, ok)
+		}
+	}
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	trie := New([]string{"x", "y", "x", "y", "x"}, []int{1, 2, 3, 4, 5})
+	if v, _ := trie.Lookup("x"); v != 5 {
+		t.Errorf("got %v, want 5", v)
+	}
+	if v, _ := trie.Lookup("y"); v != 4 {
+		t.Errorf("got %v, want 4", v)
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	trie := New(nil, nil)
+	if _, ok := trie.Lookup("a"); ok {
+		t.Errorf("found key in empty trie")
+	}
+	if n, _ := trie.LongestPrefix("abc"); n != 0 {
+		t.Errorf("got prefix %v in empty trie", n)
+	}
+
+	// The empty string is a valid key
+	trie = New([]string{""}, []int{7})
+	if v, ok := trie.Lookup(""); !ok || v != 7 {
+		t.Errorf("got (%v, %v), want (7, true)", v, ok)
+	}
+}
+
+func TestLongestPrefix(t *testing.T) {
+	keys := []string{"ham", "hamat", "hamela", "世界", "▁▁", "▁▁▁", "▁▁▁▁▁▁"}
+	values := []int{1, 2, 3, 4, 5, 6, 7}
+	trie := New(keys, values)
+
+	var tests = []struct {
+		text      string
+		wantLen   int
+		wantValue int
+	}{
+		{"zyx", 0, 0},
+		{"ham", 3, 1},
+		{"hama", 3, 1},
+		{"hamatar", 5, 2},
+		{"hamelar", 6, 3},
+		{"世界foo", 6, 4},
+		{"世", 0, 0},
+		{"▁", 0, 0},
+		{"▁▁", 6, 5},
+		{"▁▁▁▁", 9, 6},
+		{"▁▁▁▁▁▁▁", 18, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			gotLen, gotValue := trie.LongestPrefix(tt.text)
+			if gotLen != tt.wantLen || gotValue != tt.wantValue {
+				t.Errorf("got (%v, %v), want (%v, %v)", gotLen, gotValue, tt.wantLen, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestWalk(t *testing.T) {
+	trie := New([]string{"hello", "help", "he"}, []int{1, 2, 3})
+
+	n, ok := trie.Walk(Root, "he")
+	if !ok {
+		t.Fatal("expected to walk 'he'")
+	}
+	if v, ok := trie.Value(n); !ok || v != 3 {
+		t.Errorf("got (%v, %v), want (3, true)", v, ok)
+	}
+	n2, ok := trie.Walk(n, "lp")
+	if !ok {
+		t.Fatal("expected to walk 'lp'")
+	}
+	if v, ok := trie.Value(n2); !ok || v != 2 {
+		t.Errorf("got (%v, %v), want (2, true)", v, ok)
+	}
+	n3, ok := trie.Walk(n, "l")
+	if !ok {
+		t.Fatal("expected to walk 'l'")
+	}
+	if _, ok := trie.Value(n3); ok {
+		t.Errorf("got value for 'hel'")
+	}
+	if _, ok := trie.Walk(n, "x"); ok {
+		t.Errorf("expected failure walking 'hex'")
+	}
+}
+
+func TestRandomKeys(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	keySet := make(map[string]int)
+	for len(keySet) < 20000 {
+		var sb strings.Builder
+		n := 1 + rnd.Intn(12)
+		for range n {
+			// Mix ASCII with arbitrary bytes to exercise the whole alphabet.
+			if rnd.Intn(4) == 0 {
+				sb.WriteByte(byte(rnd.Intn(256)))
+			} else {
+				sb.WriteByte(byte('a' + rnd.Intn(6)))
+			}
+		}
+		keySet[sb.String()] = len(keySet)
+	}
+
+	var keys []string
+	var values []int
+	for k, v := range keySet {
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	trie := New(keys, values)
+
+	for k, v := range keySet {
+		if got, ok := trie.Lookup(k); !ok || got != v {
+			t.Fatalf("Lookup(%q) = (%v, %v), want (%v, true)", k, got, ok, v)
+		}
+		// Check some non-keys too
+		if _, ok := keySet[k+"z"]; !ok {
+			if got, ok := trie.Lookup(k + "z"); ok {
+				t.Fatalf("Lookup(%q) = %v, want not found", k+"z", got)
+			}
+		}
+	}
+
+	// Roundtrip through units
+	trie2, err := FromUnits(trie.Units())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range keySet {
+		if got, ok := trie2.Lookup(k); !ok || got != v {
+			t.Fatalf("Lookup(%q) = (%v, %v), want (%v, true)", k, got, ok, v)
+		}
+	}
+}
+
+func TestCorruptUnits(t *testing.T) {
+	if _, err := FromUnits(nil); err == nil {
+		t.Errorf("expected error for no units")
+	}
+
+	// Arbitrary units must never cause a panic.
+	rnd := rand.New(rand.NewSource(1))
+	for range 100 {
+		units := make([]uint32, 1+rnd.Intn(100))
+		for i := range units {
+			units[i] = rnd.Uint32()
+			if rnd.Intn(2) == 0 {
+				// Small offsets, which mostly stay in range.
+				units[i] &= 1<<16 - 1
+			}
+		}
+		trie, err := FromUnits(units)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range 20 {
+			key := fmt.Sprint(rnd.Intn(1000))
+			trie.Lookup(key)
+			trie.LongestPrefix(key)
+		}
+	}
+}
+
+// benchKeys generates n distinct random keys with lowercase letters.
+func benchKeys(n int) ([]string, []int) {
+	rnd := rand.New(rand.NewSource(42))
+	var keys []string
+	var values []int
+	seen := make(map[string]bool)
+	for len(keys) < n {
+		var sb strings.Builder
+		for range 1 + rnd.Intn(10) {
+			sb.WriteByte(byte('a' + rnd.Intn(26)))
+		}
+		if !seen[sb.String()] {
+			seen[sb.String()] = true
+			keys = append(keys, sb.String())
+			values = append(values, len(values))
+		}
+	}
+	return keys, values
+}
+
+func BenchmarkBuild(b *testing.B) {
+	keys, values := benchKeys(250000)
+	b.ResetTimer()
+
+	for range b.N {
+		trie := New(keys, values)
+		b.ReportMetric(float64(len(trie.Units()))/float64(len(keys)), "units/key")
+	}
+}
+
+// benchQueries generates n random queries for keys: half are keys, and half
+// are random strings that may or may not be keys, or have keys as prefixes.
+func benchQueries(keys []string, n int) []string {
+	rnd := rand.New(rand.NewSource(7))
+	queries := make([]string, n)
+	for i := range queries {
+		if i%2 == 0 {
+			queries[i] = keys[rnd.Intn(len(keys))]
+		} else {
+			var sb strings.Builder
+			for range 1 + rnd.Intn(12) {
+				sb.WriteByte(byte('a' + rnd.Intn(26)))
+			}
+			queries[i] = sb.String()
+		}
+	}
+	return queries
+}
+
+// mapTrie is a trie with a map of children per node, like the prefix matcher
+// the double-array trie replaced; it's the baseline for LongestPrefix.
+type mapTrie struct {
+	children map[byte]*mapTrie
+	value    int
+	final    bool
+}
+
+func newMapTrie(keys []string, values []int) *mapTrie {
+	root := &mapTrie{children: make(map[byte]*mapTrie)}
+	for i, key := range keys {
+		node := root
+		for j := 0; j < len(key); j++ {
+			child := node.children[key[j]]
+			if child == nil {
+				child = &mapTrie{children: make(map[byte]*mapTrie)}
+				node.children[key[j]] = child
+			}
+			node = child
+		}
+		node.value, node.final = values[i], true
+	}
+	return root
+}
+
+func (t *mapTrie) longestPrefix(text string) (int, int) {
+	node := t
+	length, value := 0, 0
+	for i := 0; i < len(text); i++ {
+		if node = node.children[text[i]]; node == nil {
+			break
+		}
+		if node.final {
+			length, value = i+1, node.value
+		}
+	}
+	return length, value
+}
+
+func BenchmarkLookup(b *testing.B) {
+	keys, values := benchKeys(250000)
+	queries := benchQueries(keys, 1<<16)
+
+	b.Run("doublearray", func(b *testing.B) {
+		trie := New(keys, values)
+		b.ResetTimer()
+		for i := range b.N {
+			trie.Lookup(queries[i%len(queries)])
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		m := make(map[string]int, len(keys))
+		for i, key := range keys {
+			m[key] = values[i]
+		}
+		b.ResetTimer()
+		for i := range b.N {
+			_ = m[queries[i%len(queries)]]
+		}
+	})
+}
+
+// BenchmarkPairLookup looks up the concatenations of pairs of keys, as
+// Encode does for neighboring symbols: the trie walks the second key from the
+// first one's node, while the map needs the concatenation in a buffer.
+func BenchmarkPairLookup(b *testing.B) {
+	keys, values := benchKeys(250000)
+	queries := benchQueries(keys, 1<<16)
+
+	b.Run("doublearray", func(b *testing.B) {
+		trie := New(keys, values)
+		nodes := make([]Node, len(queries))
+		for i, q := range queries {
+			nodes[i], _ = trie.Walk(Root, q[:len(q)/2+1])
+		}
+		b.ResetTimer()
+		for i := range b.N {
+			j := i % len(queries)
+			if n, ok := trie.Walk(nodes[j], queries[j][len(queries[j])/2+1:]); ok {
+				trie.Value(n)
+			}
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		m := make(map[string]int, len(keys))
+		for i, key := range keys {
+			m[key] = values[i]
+		}
+		buf := make([]byte, 0, 64)
+		b.ResetTimer()
+		for i := range b.N {
+			q := queries[i%len(queries)]
+			x, y := q[:len(q)/2+1], q[len(q)/2+1:]
+			buf = append(append(buf[:0], x...), y...)
+			_ = m[string(buf)]
+		}
+	})
+}
+
+func BenchmarkLongestPrefix(b *testing.B) {
+	keys, values := benchKeys(250000)
+	queries := benchQueries(keys, 1<<16)
+
+	b.Run("doublearray", func(b *testing.B) {
+		trie := New(keys, values)
+		b.ResetTimer()
+		for i := range b.N {
+			trie.LongestPrefix(queries[i%len(queries)])
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		trie := newMapTrie(keys, values)
+		b.ResetTimer()
+		for i := range b.N {
+			trie.longestPrefix(queries[i%len(queries)])
+		}
+	})
+}
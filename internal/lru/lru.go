@@ -0,0 +1,79 @@
+// Package lru provides a generic, size-bounded cache with a least-recently
+// used eviction policy. It's safe for concurrent use.
+package lru
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache is an LRU cache mapping keys of type K to values of type V.
+type Cache[K comparable, V any] struct {
+	mu   sync.Mutex
+	size int
+
+	// ll holds the entries, from the most recently used to the least recently
+	// used; items maps keys to their elements in ll.
+	ll    *list.List
+	items map[K]*list.Element
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// New creates a new Cache holding at most size entries. size must be
+// positive.
+func New[K comparable, V any](size int) *Cache[K, V] {
+	if size <= 0 {
+		panic("lru: size must be positive")
+	}
+	return &Cache[K, V]{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[K]*list.Element),
+	}
+}
+
+// Get looks up key in the cache, and returns its value and true if found.
+// The entry is marked as the most recently used.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.ll.MoveToFront(elem)
+		return elem.Value.(*entry[K, V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Add adds a key-value pair to the cache, replacing the value of key if it's
+// already there. If the cache is full, the least recently used entry is
+// evicted.
+func (c *Cache[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.ll.MoveToFront(elem)
+		elem.Value.(*entry[K, V]).value = value
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&entry[K, V]{key, value})
+	if c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry[K, V]).key)
+	}
+}
+
+// Len returns the number of entries in the cache.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
@@ -0,0 +1,71 @@
+package lru
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestGetAdd(t *testing.T) {
+	c := New[string, int](2)
+
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("found key in empty cache")
+	}
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("got (%v, %v), want (1, true)", v, ok)
+	}
+
+	// "b" is now the least recently used, so adding "c" evicts it.
+	c.Add("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("expected b to be evicted")
+	}
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("got (%v, %v), want (1, true)", v, ok)
+	}
+	if v, ok := c.Get("c"); !ok || v != 3 {
+		t.Errorf("got (%v, %v), want (3, true)", v, ok)
+	}
+	if c.Len() != 2 {
+		t.Errorf("got len %v, want 2", c.Len())
+	}
+
+	// Replacing a value doesn't grow the cache.
+	c.Add("a", 10)
+	if v, _ := c.Get("a"); v != 10 {
+		t.Errorf("got %v, want 10", v)
+	}
+	if c.Len() != 2 {
+		t.Errorf("got len %v, want 2", c.Len())
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	c := New[string, int](50)
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 1000 {
+				key := fmt.Sprint((g * i) % 100)
+				if v, ok := c.Get(key); ok && fmt.Sprint(v) != key {
+					t.Errorf("got %v for key %v", v, key)
+				}
+				var n int
+				fmt.Sscan(key, &n)
+				c.Add(key, n)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if c.Len() > 50 {
+		t.Errorf("got len %v, want <= 50", c.Len())
+	}
+}
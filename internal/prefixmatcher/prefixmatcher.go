@@ -1,68 +1,43 @@
 package prefixmatcher
 
 import (
-	"unicode/utf8"
+	"github.com/eliben/go-sentencepiece/internal/doublearray"
 )
 
 // PrefixMatcher helps find longest prefixes. See [FindPrefixLen].
 type PrefixMatcher struct {
-	root *trieNode
-}
-
-type trieNode struct {
-	children map[rune]*trieNode
-	final    bool
+	trie *doublearray.Trie
 }
 
 // NewFromSet creates a new [PrefixMatcher] from a set of strings tha represent
 // the vocabulary.
 func NewFromSet(vocab map[string]bool) *PrefixMatcher {
-	pm := &PrefixMatcher{root: newNode()}
+	words := make([]string, 0, len(vocab))
 	for word := range vocab {
-		pm.add(word)
+		words = append(words, word)
 	}
-	return pm
+	return &PrefixMatcher{trie: doublearray.New(words, make([]int, len(words)))}
 }
 
-// FindPrefixLen finds the longest prefix of text that matches a vocabulary
-// word, and returns it. If 0 is returned, no prefix was found.
-func (pm *PrefixMatcher) FindPrefixLen(text string) int {
-	node := pm.root
-	maxLen := 0
-
-	for i, r := range text {
-		child := node.children[r]
-		if child == nil {
-			// r not found in this node, so we're done.
-			return maxLen
-		}
-		if child.final {
-			maxLen = i + utf8.RuneLen(r)
-		}
-		node = child
+// NewFromUnits creates a new [PrefixMatcher] from the representation
+// returned by [Units]. units is used directly, without copying.
+func NewFromUnits(units []uint32) (*PrefixMatcher, error) {
+	trie, err := doublearray.FromUnits(units)
+	if err != nil {
+		return nil, err
 	}
-
-	return maxLen
+	return &PrefixMatcher{trie: trie}, nil
 }
 
-func (pm *PrefixMatcher) add(word string) {
-	node := pm.root
-
-	for _, r := range word {
-		child := node.children[r]
-		if child == nil {
-			child = newNode()
-			node.children[r] = child
-		}
-		node = child
-	}
-
-	node.final = true
+// Units returns the underlying representation of the matcher's trie; see
+// [doublearray.Trie.Units].
+func (pm *PrefixMatcher) Units() []uint32 {
+	return pm.trie.Units()
 }
 
-func newNode() *trieNode {
-	return &trieNode{
-		children: make(map[rune]*trieNode),
-		final:    false,
-	}
+// FindPrefixLen finds the longest prefix of text that matches a vocabulary
+// word, and returns it. If 0 is returned, no prefix was found.
+func (pm *PrefixMatcher) FindPrefixLen(text string) int {
+	length, _ := pm.trie.LongestPrefix(text)
+	return length
 }
@@ -1,21 +1,9 @@
 package prefixmatcher
 
 import (
-	"fmt"
 	"testing"
 )
 
-func dumpNode(n *trieNode, prefix string) string {
-	var s string
-	if n.final {
-		s = fmt.Sprintf("%sfinal\n", prefix)
-	}
-	for r, c := range n.children {
-		s += fmt.Sprintf("%s%q ->\n%s", prefix, r, dumpNode(c, prefix+"  "))
-	}
-	return s
-}
-
 func TestSmallVocab(t *testing.T) {
 	vocab := map[string]bool{
 		"ham":    true,
@@ -105,3 +93,25 @@ func TestSingleAndDoubleLetter(t *testing.T) {
 		}
 	}
 }
+
+func TestUnits(t *testing.T) {
+	vocab := map[string]bool{
+		"ham":    true,
+		"hamat":  true,
+		"yefet":  true,
+		"世界":     true,
+		"▁▁":     true,
+		"▁▁▁▁▁▁": true,
+	}
+	pm := NewFromSet(vocab)
+
+	pm2, err := NewFromUnits(pm.Units())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"hamatar", "hame", "yefet", "世界foo", "▁▁▁p", "▁▁▁▁▁▁▁", "zzz"} {
+		if got, want := pm2.FindPrefixLen(text), pm.FindPrefixLen(text); got != want {
+			t.Errorf("%q: got %v, want %v", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package sentencepiece
+
+import "os"
+
+// mmapFile falls back to reading the whole file on platforms where we don't
+// memory-map files.
+func mmapFile(path string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,369 @@
+package sentencepiece
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/eliben/go-sentencepiece/internal/charsmap"
+	"github.com/eliben/go-sentencepiece/internal/doublearray"
+	"github.com/eliben/go-sentencepiece/internal/model"
+	"github.com/eliben/go-sentencepiece/internal/prefixmatcher"
+	"google.golang.org/protobuf/proto"
+)
+
+// Model is a loaded SentencePiece model: the model proto along with the
+// lookup structures derived from it. A Model is immutable once loaded, so a
+// single Model can be shared by any number of Processors (see
+// [NewProcessorFromModel]) without duplicating its vocabulary.
+//
+// A Model can be loaded either from the SentencePiece model proto, or from
+// the compact precompiled format written by [Model.WriteCompiled].
+type Model struct {
+	// proto holds the model proto; for models loaded from the precompiled
+	// format, it holds everything except the pieces, which are only found in
+	// the piece table.
+	proto *model.ModelProto
+
+	// The piece table is a flat representation of the model's pieces: the
+	// text of piece i is pieceText[pieceOffsets[i]:pieceOffsets[i+1]], and
+	// pieceScores[i], pieceTypes[i] are its score and type.
+	pieceOffsets []uint32
+	pieceText    string
+	pieceScores  []float32
+	pieceTypes   []uint8
+
+	// normalTrie and reservedTrie map piece text to IDs. normalTrie has the
+	// pieces that encoding can produce (normal, user-defined and unused
+	// pieces), and reservedTrie has all the others.
+	normalTrie   *doublearray.Trie
+	reservedTrie *doublearray.Trie
+
+	// unknownID is the token identifier of the UNKNOWN piece
+	unknownID int
+
+	// userDefinedMatcher is a prefix matcher for symbols that are of
+	// "user-defined" type in the model proto.
+	userDefinedMatcher *prefixmatcher.PrefixMatcher
+
+	// byte2Token is a cache of byte values and the tokens they represent
+	byte2Token [256]Token
+
+	// idToByte maps IDs to byte values they represent
+	idToByte map[int]byte
+
+	// normalizer normalizes text before encoding, following the normalizer
+	// spec.
+	normalizer *Normalizer
+
+	// denormalizer holds the rules of the denormalizer spec, which decoding
+	// applies to the decoded text; it's nil if the spec has no rules.
+	denormalizer *charsmap.Map
+
+	// noSplit is the set of runes next to which pre-tokenization can't
+	// split words; see noSplitRunes.
+	noSplitOnce sync.Once
+	noSplit     map[rune]bool
+
+	// fingerprint is computed lazily by Fingerprint.
+	fingerprintOnce sync.Once
+	fingerprint     string
+
+	// tokenTrie is built lazily by TokenTrie.
+	tokenTrieOnce sync.Once
+	tokenTrie     *TokenTrie
+}
+
+// LoadModel loads a Model from a reader with the protobuf data, or with a
+// precompiled model (see [Model.WriteCompiled]).
+func LoadModel(protoReader io.Reader) (*Model, error) {
+	b, err := io.ReadAll(protoReader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read protobuf data: %v", err)
+	}
+	return LoadModelFromBytes(b)
+}
+
+// LoadModelFromBytes loads a Model from the protobuf data in b. This is
+// convenient for models embedded into the binary with go:embed.
+//
+// b may also hold a precompiled model (see [Model.WriteCompiled]). In this
+// case the Model refers to b directly instead of copying it, so b should not
+// be modified afterwards.
+func LoadModelFromBytes(b []byte) (*Model, error) {
+	if isCompiledModel(b) {
+		return loadCompiledModel(b)
+	}
+
+	var mp model.ModelProto
+	err := proto.Unmarshal(b, &mp)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal protobuf: %v", err)
+	}
+	return newModel(&mp)
+}
+
+// LoadModelFromPath loads a Model from a file path to the protobuf data.
+func LoadModelFromPath(protoFile string) (*Model, error) {
+	b, err := os.ReadFile(protoFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %q: %v", protoFile, err)
+	}
+	return LoadModelFromBytes(b)
+}
+
+// LoadModelFromFS loads a Model from the file name in fsys; fsys can be an
+// [embed.FS], [os.DirFS] or any other [fs.FS].
+func LoadModelFromFS(fsys fs.FS, name string) (*Model, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %q: %v", name, err)
+	}
+	return LoadModelFromBytes(b)
+}
+
+// LoadModelMmap loads a Model from a file path to the protobuf data, by
+// memory-mapping the file instead of reading it into a heap buffer.
+//
+// Only precompiled models (see [Model.WriteCompiled]) benefit from this: the
+// Model uses the mapped data in place, so loading is nearly instantaneous and
+// the pages are shared between processes using the same file. The mapping is
+// never released; it lives for the rest of the process even if the Model is no
+// longer used, and the file must not be modified meanwhile. Use it for models
+// that are loaded once and kept, not for models loaded repeatedly.
+//
+// A model proto is unmarshaled and copied onto the heap like with
+// [LoadModelFromPath], and its mapping is released before LoadModelMmap
+// returns.
+//
+// On platforms that don't support memory-mapping files, this falls back to
+// reading the file.
+func LoadModelMmap(protoFile string) (*Model, error) {
+	b, unmap, err := mmapFile(protoFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to map %q: %v", protoFile, err)
+	}
+	if isCompiledModel(b) {
+		m, err := loadCompiledModel(b)
+		if err != nil {
+			unmap()
+		}
+		return m, err
+	}
+	defer unmap()
+	return LoadModelFromBytes(b)
+}
+
+// newModel creates a new Model from an unmarshaled model proto, validating
+// it and building the lookup structures.
+func newModel(mp *model.ModelProto) (*Model, error) {
+	if err := checkModelSpecs(mp); err != nil {
+		return nil, err
+	}
+
+	m := &Model{
+		proto:        mp,
+		pieceOffsets: make([]uint32, 1, len(mp.GetPieces())+1),
+		pieceScores:  make([]float32, 0, len(mp.GetPieces())),
+		pieceTypes:   make([]uint8, 0, len(mp.GetPieces())),
+		unknownID:    -1,
+	}
+
+	var sb strings.Builder
+	userDefined := make(map[string]bool)
+	var normalIDs, reservedIDs []int
+	foundBytes := 0
+
+	for i, piece := range mp.GetPieces() {
+		sb.WriteString(piece.GetPiece())
+		m.pieceOffsets = append(m.pieceOffsets, uint32(sb.Len()))
+		m.pieceScores = append(m.pieceScores, piece.GetScore())
+		m.pieceTypes = append(m.pieceTypes, uint8(piece.GetType()))
+
+		if isNormalPieceType(piece.GetType()) {
+			normalIDs = append(normalIDs, i)
+		} else {
+			reservedIDs = append(reservedIDs, i)
+		}
+
+		if piece.GetType() == model.ModelProto_SentencePiece_USER_DEFINED {
+			userDefined[piece.GetPiece()] = true
+		} else if piece.GetType() == model.ModelProto_SentencePiece_UNKNOWN {
+			if m.unknownID > 0 {
+				return nil, fmt.Errorf("unk redefined")
+			}
+			m.unknownID = i
+		} else if piece.GetType() == model.ModelProto_SentencePiece_BYTE {
+			if !mp.GetTrainerSpec().GetByteFallback() {
+				return nil, fmt.Errorf("byte piece %q is found although `byte_fallback=false`", piece.GetPiece())
+			}
+			bv := convertHexValue(piece.GetPiece())
+			if bv >= 0 && bv < 256 {
+				if m.byte2Token[bv].Text == "" {
+					foundBytes++
+				}
+				m.byte2Token[bv] = Token{ID: i, Text: piece.GetPiece()}
+			}
+		}
+	}
+	m.pieceText = sb.String()
+
+	if m.unknownID < 0 {
+		return nil, fmt.Errorf("unk symbol is not defined")
+	}
+
+	// In case byte_fallback is specified, make sure that all 256 possible byte
+	// values were found.
+	if mp.GetTrainerSpec().GetByteFallback() && foundBytes < 256 {
+		for i := 0; i < 256; i++ {
+			if m.byte2Token[i].Text == "" {
+				return nil, fmt.Errorf("byte value 0x%02X not found", i)
+			}
+		}
+	}
+
+	m.normalTrie = m.buildTrie(normalIDs)
+	m.reservedTrie = m.buildTrie(reservedIDs)
+	m.userDefinedMatcher = prefixmatcher.NewFromSet(userDefined)
+	m.initIDToByte()
+	if err := m.initNormalizers(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// initNormalizers initializes m.normalizer and m.denormalizer from the
+// normalizer and denormalizer specs. The rules of each spec are read from its
+// precompiled charsmap if it has one, and otherwise from its rule TSV. It must
+// be called after the piece table is set.
+func (m *Model) initNormalizers() error {
+	rules, err := newCharsMap(m.proto.GetNormalizerSpec())
+	if err != nil {
+		return fmt.Errorf("unable to load normalizer: %v", err)
+	}
+	m.normalizer = newModelNormalizer(m, rules)
+
+	m.denormalizer, err = newCharsMap(m.proto.GetDenormalizerSpec())
+	if err != nil {
+		return fmt.Errorf("unable to load denormalizer: %v", err)
+	}
+	return nil
+}
+
+// Normalizer returns the model's Normalizer, which normalizes text exactly
+// like encoding with the model does. See also [Processor.Normalizer].
+func (m *Model) Normalizer() *Normalizer {
+	return m.normalizer
+}
+
+// userDefinedSymbols returns the set of the model's user-defined pieces.
+func (m *Model) userDefinedSymbols() map[string]bool {
+	symbols := make(map[string]bool)
+	for id := range m.numPieces() {
+		if m.pieceType(id) == model.ModelProto_SentencePiece_USER_DEFINED {
+			symbols[m.pieceString(id)] = true
+		}
+	}
+	return symbols
+}
+
+// newCharsMap creates the character map of a normalizer spec, or returns nil
+// if the spec has no normalization rules.
+func newCharsMap(spec *model.NormalizerSpec) (*charsmap.Map, error) {
+	precompiled := spec.GetPrecompiledCharsmap()
+	if len(precompiled) == 0 {
+		tsv := spec.GetNormalizationRuleTsv()
+		if tsv == "" {
+			return nil, nil
+		}
+		rules, err := charsmap.ParseRules(tsv)
+		if err != nil {
+			return nil, err
+		}
+		if len(rules) == 0 {
+			return nil, nil
+		}
+		if precompiled, err = charsmap.Compile(rules); err != nil {
+			return nil, err
+		}
+	}
+	return charsmap.New(precompiled)
+}
+
+// checkModelSpecs verifies that the trainer spec of mp only uses options we
+// support.
+func checkModelSpecs(mp *model.ModelProto) error {
+	tspec := mp.GetTrainerSpec()
+	switch tspec.GetModelType() {
+	case model.TrainerSpec_BPE, model.TrainerSpec_WORD, model.TrainerSpec_CHAR:
+	default:
+		return fmt.Errorf("model type %s not supported", tspec.GetModelType())
+	}
+	return nil
+}
+
+// isNormalPieceType reports whether pieces of type t can be produced by
+// merging symbols during encoding.
+func isNormalPieceType(t model.ModelProto_SentencePiece_Type) bool {
+	return t == model.ModelProto_SentencePiece_NORMAL ||
+		t == model.ModelProto_SentencePiece_USER_DEFINED ||
+		t == model.ModelProto_SentencePiece_UNUSED
+}
+
+// initIDToByte initializes m.idToByte from m.byte2Token.
+func (m *Model) initIDToByte() {
+	m.idToByte = make(map[int]byte)
+	for bv, tok := range m.byte2Token {
+		if tok.Text != "" {
+			m.idToByte[tok.ID] = byte(bv)
+		}
+	}
+}
+
+// numPieces returns the number of pieces in the model's vocabulary.
+func (m *Model) numPieces() int {
+	return len(m.pieceScores)
+}
+
+// pieceString returns the text of the piece with the given ID.
+func (m *Model) pieceString(id int) string {
+	return m.pieceText[m.pieceOffsets[id]:m.pieceOffsets[id+1]]
+}
+
+// pieceType returns the type of the piece with the given ID.
+func (m *Model) pieceType(id int) model.ModelProto_SentencePiece_Type {
+	return model.ModelProto_SentencePiece_Type(m.pieceTypes[id])
+}
+
+// buildTrie builds a trie mapping the text of the pieces with the given IDs
+// to their IDs. When several pieces have the same text, the last one wins.
+func (m *Model) buildTrie(ids []int) *doublearray.Trie {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = m.pieceString(id)
+	}
+	return doublearray.New(keys, ids)
+}
+
+// lookupPiece finds the ID of the piece with text s in trie.
+func (m *Model) lookupPiece(trie *doublearray.Trie, s string) (int, bool) {
+	n, ok := trie.Walk(doublearray.Root, s)
+	if !ok {
+		return 0, false
+	}
+	return m.nodePiece(trie, n)
+}
+
+// nodePiece returns the ID of the piece whose text ends at node n of trie, if
+// there is one. The ID is range-checked, because the tries of precompiled
+// models aren't validated when they're loaded.
+func (m *Model) nodePiece(trie *doublearray.Trie, n doublearray.Node) (int, bool) {
+	id, ok := trie.Value(n)
+	if !ok || id >= m.numPieces() {
+		return 0, false
+	}
+	return id, true
+}
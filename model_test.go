@@ -0,0 +1,96 @@
+package sentencepiece
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+const sampleText = "hiƻ <td>🤨there ⇲bob, สวัสดี\nif allow == true { return x;}"
+
+func TestLoadModelVariants(t *testing.T) {
+	protoFile := modelPath(t)
+	wantTokens := createProcessor(t).Encode(sampleText)
+
+	b, err := os.ReadFile(protoFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaders := map[string]func() (*Processor, error){
+		"NewProcessor": func() (*Processor, error) {
+			f, err := os.Open(protoFile)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			return NewProcessor(f)
+		},
+		"NewProcessorFromBytes": func() (*Processor, error) {
+			return NewProcessorFromBytes(b)
+		},
+		"NewProcessorFromFS/DirFS": func() (*Processor, error) {
+			dir, name := filepath.Split(protoFile)
+			return NewProcessorFromFS(os.DirFS(dir), name)
+		},
+		"NewProcessorFromFS/MapFS": func() (*Processor, error) {
+			fsys := fstest.MapFS{"models/tokenizer.model": {Data: b}}
+			return NewProcessorFromFS(fsys, "models/tokenizer.model")
+		},
+		"NewProcessorFromMmap": func() (*Processor, error) {
+			return NewProcessorFromMmap(protoFile)
+		},
+	}
+
+	for name, loader := range loaders {
+		t.Run(name, func(t *testing.T) {
+			proc, err := loader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := proc.Encode(sampleText)
+			if !slices.Equal(got, wantTokens) {
+				t.Errorf("got  %v\nwant: %v\n", got, wantTokens)
+			}
+		})
+	}
+}
+
+func TestLoadModelErrors(t *testing.T) {
+	if _, err := LoadModelFromPath(filepath.Join(t.TempDir(), "nonexistent.model")); err == nil {
+		t.Error("expected error for nonexistent file")
+	}
+	if _, err := LoadModelMmap(filepath.Join(t.TempDir(), "nonexistent.model")); err == nil {
+		t.Error("expected error for nonexistent file")
+	}
+	if _, err := LoadModelFromFS(fstest.MapFS{}, "tokenizer.model"); err == nil {
+		t.Error("expected error for missing file in FS")
+	}
+	if _, err := LoadModelFromBytes([]byte("not a model proto")); err == nil {
+		t.Error("expected error for invalid proto data")
+	}
+}
+
+func TestSharedModel(t *testing.T) {
+	m, err := LoadModelFromPath(modelPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc1 := NewProcessorFromModel(m)
+	proc2 := NewProcessorFromModel(m)
+	if proc1.Model() != m || proc2.Model() != m {
+		t.Errorf("processors don't share the model")
+	}
+
+	toks1 := proc1.Encode(sampleText)
+	toks2 := proc2.Encode(sampleText)
+	if !slices.Equal(toks1, toks2) {
+		t.Errorf("got different tokens from processors sharing a model:\n%v\n%v", toks1, toks2)
+	}
+	if text := proc2.DecodeTokens(toks1); text != sampleText {
+		t.Errorf("got %q, want %q", text, sampleText)
+	}
+}
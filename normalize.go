@@ -1,18 +1,280 @@
 package sentencepiece
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
 
-// normalize performs unicode normalization.
+	"github.com/eliben/go-sentencepiece/internal/charsmap"
+	"github.com/eliben/go-sentencepiece/internal/prefixmatcher"
+)
+
+// Normalizer normalizes text the way a model does before encoding it: it
+// applies the model's normalization rules, replacing substrings of the text
+// (preferring the longest match at each position), and then handles
+// whitespace as the model's normalizer spec says: it may remove leading,
+// trailing and repeated spaces, add a dummy space at the start of the text
+// (or at its end, for models that treat whitespace as a suffix), and replace
+// spaces by the whitespace separator "▁".
 //
-// SentencePiece has a feature to perform configurable unicode normalization on
-// the input text and has some options for adding dummy whitespace prefixes or
-// trimming whitespace. However, the model we're working with has a very simple
-// normalizer that does none of this. These options can be added in the future
-// if needed.
-func normalize(text string) string {
+// A Normalizer is immutable, and safe for concurrent use.
+type Normalizer struct {
+	// rules holds the normalization rules, or is nil if there are none.
+	rules *charsmap.Map
+
+	// matcher matches the user-defined symbols of the model, which are copied
+	// verbatim rather than normalized. The symbols are matched in their
+	// original form, with spaces rather than separators. It's nil if there
+	// are no rules (the symbols are copied anyway), and for standalone
+	// Normalizers.
+	matcher *prefixmatcher.PrefixMatcher
+
+	// The whitespace options of the normalizer spec.
+	addDummyPrefix         bool
+	removeExtraWhitespaces bool
+	escapeWhitespaces      bool
+
+	// treatWhitespaceAsSuffix is the trainer spec option: if set, the dummy
+	// space is added at the end of the text rather than at its start.
+	treatWhitespaceAsSuffix bool
+}
+
+// newModelNormalizer creates the Normalizer of m, applying rules (which may be
+// nil).
+func newModelNormalizer(m *Model, rules *charsmap.Map) *Normalizer {
+	nspec := m.proto.GetNormalizerSpec()
+	n := &Normalizer{
+		rules:                   rules,
+		addDummyPrefix:          nspec.GetAddDummyPrefix(),
+		removeExtraWhitespaces:  nspec.GetRemoveExtraWhitespaces(),
+		escapeWhitespaces:       nspec.GetEscapeWhitespaces(),
+		treatWhitespaceAsSuffix: m.proto.GetTrainerSpec().GetTreatWhitespaceAsSuffix(),
+	}
+	return n.withSymbols(m.userDefinedSymbols())
+}
+
+// withSymbols returns a copy of n that keeps symbols, which are in normalized
+// form, verbatim.
+func (n *Normalizer) withSymbols(symbols map[string]bool) *Normalizer {
+	c := *n
+	c.matcher = nil
+	if c.rules != nil && len(symbols) > 0 {
+		original := make(map[string]bool, len(symbols))
+		for sym := range symbols {
+			original[c.unescape(sym)] = true
+		}
+		c.matcher = prefixmatcher.NewFromSet(original)
+	}
+	return &c
+}
+
+// NewNormalizer creates a standalone Normalizer from normalization rules in
+// the format of SentencePiece's normalization_rule_tsv: each line has a source
+// and a target, separated by a tab, where each is a sequence of Unicode code
+// points written in hex and separated by spaces (e.g. "201C\t22" replaces
+// left double quotes by plain ones). Text after a "#" and empty lines are
+// ignored, and an empty target removes the source from the text. The
+// Normalizer replaces spaces by "▁", but doesn't otherwise change whitespace.
+//
+// To normalize text exactly like a model does, use [Model.Normalizer].
+func NewNormalizer(ruleTSV string) (*Normalizer, error) {
+	rules, err := charsmap.ParseRules(ruleTSV)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse normalization rules: %v", err)
+	}
+	n := &Normalizer{escapeWhitespaces: true}
+	if len(rules) > 0 {
+		precompiled, err := charsmap.Compile(rules)
+		if err != nil {
+			return nil, fmt.Errorf("unable to compile normalization rules: %v", err)
+		}
+		if n.rules, err = charsmap.New(precompiled); err != nil {
+			return nil, fmt.Errorf("unable to compile normalization rules: %v", err)
+		}
+	}
+	return n, nil
+}
+
+// Normalize returns the normalized form of text.
+func (n *Normalizer) Normalize(text string) string {
+	normalized, _ := n.normalize(text, false)
+	return normalized
+}
+
+// NormalizeWithAlignment is like Normalize, but also returns the alignment of
+// the normalized text to text: alignment[i] is the offset in text of the
+// character (or the substring replaced by a rule) that byte i of the
+// normalized text was produced from, and the last element, at
+// len(normalized), is len(text). The alignment is non-decreasing, so the
+// range of text that normalized[i:j] came from is
+// text[alignment[i]:alignment[j]], when j is at the start of a character.
+// A dummy space added at the start of the text is aligned to the first
+// character kept, and one added at the end to the end of the last one.
+func (n *Normalizer) NormalizeWithAlignment(text string) (normalized string, alignment []int) {
+	return n.normalize(text, true)
+}
+
+// normalize implements Normalize and NormalizeWithAlignment; the alignment is
+// only computed if align is true. It follows Normalizer::Normalize in the C++
+// library.
+//
+// Without normalization rules, invalid UTF-8 in text is kept as is, so that
+// it's encoded with byte fallback; otherwise it's replaced by U+FFFD, as in
+// SentencePiece.
+func (n *Normalizer) normalize(text string, align bool) (string, []int) {
+	if !align && n.rules == nil && !n.addDummyPrefix && !n.removeExtraWhitespaces {
+		return n.escape(text), nil
+	}
+
+	buf := make([]byte, 0, len(text)+len(text)/2)
+	var alignment []int
+
+	// write appends s to the normalized text, as produced from text at offset.
+	write := func(s string, offset int) {
+		buf = append(buf, s...)
+		if align {
+			for len(alignment) < len(buf) {
+				alignment = append(alignment, offset)
+			}
+		}
+	}
+	space := n.whitespace()
+	endsWithSpace := func() bool {
+		return len(buf) >= len(space) && string(buf[len(buf)-len(space):]) == space
+	}
+
+	// Skip leading spaces.
+	pos := 0
+	if n.removeExtraWhitespaces {
+		for pos < len(text) {
+			normalized, size := n.normalizePrefix(text[pos:])
+			if normalized != " " {
+				break
+			}
+			pos += size
+		}
+	}
+	if pos == len(text) {
+		if align {
+			alignment = append(alignment, len(text))
+		}
+		return "", alignment
+	}
+
+	if n.addDummyPrefix && !n.treatWhitespaceAsSuffix {
+		write(space, pos)
+	}
+
+	// Write the normalized text, escaping spaces; when removing extra
+	// whitespace, spaces following another space are dropped.
+	isPrevSpace := n.removeExtraWhitespaces
+	for pos < len(text) {
+		normalized, size := n.normalizePrefix(text[pos:])
+		if isPrevSpace {
+			normalized = strings.TrimLeft(normalized, " ")
+		}
+		if normalized != "" {
+			isPrevSpace = strings.HasSuffix(normalized, " ")
+			for {
+				i := strings.IndexByte(normalized, ' ')
+				if i < 0 {
+					write(normalized, pos)
+					break
+				}
+				write(normalized[:i], pos)
+				write(space, pos)
+				normalized = normalized[i+1:]
+			}
+		}
+		pos += size
+		if !n.removeExtraWhitespaces {
+			isPrevSpace = false
+		}
+	}
+
+	// Remove trailing spaces; a dummy suffix is aligned to the first of them.
+	end := len(text)
+	if n.removeExtraWhitespaces {
+		for endsWithSpace() {
+			buf = buf[:len(buf)-len(space)]
+			if align {
+				end = alignment[len(buf)]
+				alignment = alignment[:len(buf)]
+			}
+		}
+	}
+	if n.addDummyPrefix && n.treatWhitespaceAsSuffix {
+		write(space, end)
+	}
+
+	if align {
+		alignment = append(alignment, len(text))
+	}
+	return string(buf), alignment
+}
+
+// normalizePrefix normalizes the start of text, which must not be empty: a
+// user-defined symbol is kept as is, the longest source of a rule is
+// replaced, and otherwise the first character is kept. It returns the
+// normalized text, with spaces (rather than separators), and the length of
+// the prefix of text it was produced from.
+func (n *Normalizer) normalizePrefix(text string) (string, int) {
+	if n.matcher != nil {
+		if size := n.matcher.FindPrefixLen(text); size > 0 {
+			return text[:size], size
+		}
+	}
+	if n.rules != nil {
+		return n.rules.NormalizePrefix(text)
+	}
+	_, size := utf8.DecodeRuneInString(text)
+	return text[:size], size
+}
+
+// whitespace returns the string that represents spaces in normalized text and
+// in the model's pieces: the whitespace separator, or a space if the
+// normalizer doesn't escape whitespace.
+func (n *Normalizer) whitespace() string {
+	if n.escapeWhitespaces {
+		return whitespaceSeparator
+	}
+	return " "
+}
+
+// escape replaces the spaces of text by the normalizer's whitespace.
+func (n *Normalizer) escape(text string) string {
+	if !n.escapeWhitespaces {
+		return text
+	}
 	return replaceSpacesBySeparator(text)
 }
 
+// unescape replaces the normalizer's whitespace in text (e.g. a piece) by
+// spaces.
+func (n *Normalizer) unescape(text string) string {
+	if !n.escapeWhitespaces {
+		return text
+	}
+	return replaceSeparatorsBySpace(text)
+}
+
+// hasDummyWhitespace reports whether the whitespace at the start of
+// normalized text (or at its end, if whitespace is a suffix) is always a
+// dummy, which decoding removes. As in the C++ library, this is assumed when
+// the normalizer adds a dummy prefix, or removes extra whitespace.
+func (n *Normalizer) hasDummyWhitespace() bool {
+	return n.addDummyPrefix || n.removeExtraWhitespaces
+}
+
+// trimDummyWhitespace removes the dummy whitespace from piece, which is the
+// first piece decoded (or the last one, if whitespace is a suffix).
+func (n *Normalizer) trimDummyWhitespace(piece string) string {
+	if n.treatWhitespaceAsSuffix {
+		return strings.TrimSuffix(piece, n.whitespace())
+	}
+	return strings.TrimPrefix(piece, n.whitespace())
+}
+
 const whitespaceSeparator = "▁"
 
 // replaceSpacesBySeparator replaces spaces by the whitespace separator used by
@@ -0,0 +1,223 @@
+package sentencepiece
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// punctuationRules are normalization rules for fancy quotes, dashes and
+// ellipses.
+const punctuationRules = `# Quotes
+201C	22
+201D	22
+2018	27
+2019	27
+
+2014	2D 2D  # em dash
+2E 2E 2E	2026
+2E 2E 2E 2E	2E
+00AD		# soft hyphen
+`
+
+func TestNewNormalizer(t *testing.T) {
+	n, err := NewNormalizer(punctuationRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		text, want string
+	}{
+		{"", ""},
+		{"plain text", "plain▁text"},
+		{"“quoted” and ‘single’", `"quoted"▁and▁'single'`},
+		{"wait—what", "wait--what"},
+		{"so.. so... so.... so.....", "so..▁so…▁so.▁so.."},
+		{"soft­hyphen", "softhyphen"},
+	}
+	for _, tt := range tests {
+		if got := n.Normalize(tt.text); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+
+	// Without rules, only spaces are replaced.
+	n, err = NewNormalizer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n.Normalize("“a b”"), "“a▁b”"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, tsv := range []string{"201C", "201C\tXYZ", "\t22", "110000\t22"} {
+		if _, err := NewNormalizer(tsv); err == nil {
+			t.Errorf("got no error for rules %q", tsv)
+		}
+	}
+}
+
+func TestEncodeNormalizationRules(t *testing.T) {
+	proc := createProcessor(t)
+
+	mp := loadModelProto(t)
+	mp.NormalizerSpec.NormalizationRuleTsv = proto.String(punctuationRules + "3C\t2039\n")
+	m, err := newModel(mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rules must survive a precompiled round trip.
+	var buf bytes.Buffer
+	if err := m.WriteCompiled(&buf); err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := LoadModelFromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// User-defined symbols aren't normalized: "<td>" stays a symbol, while
+	// other "<"s are replaced by "‹".
+	text := "<td> “quoted”—and... a<b"
+	normalized := "<td>▁\"quoted\"--and…▁a‹b"
+	for _, m := range []*Model{m, compiled} {
+		if got := m.Normalizer().Normalize(text); got != normalized {
+			t.Errorf("got normalized %q, want %q", got, normalized)
+		}
+
+		want := proc.Encode(replaceSeparatorsBySpace(normalized))
+		for _, opts := range [][]Option{nil, {WithWordCache(100)}} {
+			if got := NewProcessorFromModel(m, opts...).Encode(text); !slices.Equal(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		}
+	}
+
+	// Models without rules normalize only spaces.
+	if got, want := proc.Model().Normalizer().Normalize("“a b”"), "“a▁b”"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNormalizeWithAlignment(t *testing.T) {
+	n, err := NewNormalizer("201C\t22\n2014\t2D 2D\n2E 2E 2E\t2026\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := NewNormalizer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		n             *Normalizer
+		text          string
+		want          string
+		wantAlignment []int
+	}{
+		{n, "", "", []int{0}},
+		{n, "“a b—c", `"a▁b--c`, []int{0, 3, 4, 4, 4, 5, 6, 6, 9, 10}},
+		{n, "x...y", "x…y", []int{0, 1, 1, 1, 4, 5}},
+		{identity, "a b", "a▁b", []int{0, 1, 1, 1, 2, 3}},
+		{identity, "“a", "“a", []int{0, 0, 0, 3, 4}},
+	}
+	for _, tt := range tests {
+		got, alignment := tt.n.NormalizeWithAlignment(tt.text)
+		if got != tt.want || !slices.Equal(alignment, tt.wantAlignment) {
+			t.Errorf("NormalizeWithAlignment(%q) = %q, %v; want %q, %v", tt.text, got, alignment, tt.want, tt.wantAlignment)
+		}
+		if normalized := tt.n.Normalize(tt.text); normalized != got {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.text, normalized, got)
+		}
+	}
+}
+
+func TestProcessorNormalizer(t *testing.T) {
+	mp := loadModelProto(t)
+	mp.NormalizerSpec.NormalizationRuleTsv = proto.String("3C\t2039\n3E\t203A\n")
+	m, err := newModel(mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Protected symbols are kept verbatim by the processor's normalizer, even
+	// with spaces, but not by the model's.
+	proc := NewProcessorFromModel(m, WithProtectedSymbols("<a b>"))
+	text := "<td> <a b> <c>"
+	var tests = []struct {
+		n    *Normalizer
+		want string
+	}{
+		{m.Normalizer(), "<td>▁‹a▁b›▁‹c›"},
+		{proc.Normalizer(), "<td>▁<a▁b>▁‹c›"},
+	}
+	for _, tt := range tests {
+		got, alignment := tt.n.NormalizeWithAlignment(text)
+		if got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+		if len(alignment) != len(got)+1 || alignment[len(got)] != len(text) || !slices.IsSorted(alignment) {
+			t.Errorf("got bad alignment %v for %q", alignment, got)
+		}
+
+		// Each character of the normalized text maps back to the start of a
+		// character in text.
+		for i := range got {
+			if !utf8.RuneStart(text[alignment[i]]) {
+				t.Errorf("got alignment %d for byte %d of %q, inside a character", alignment[i], i, got)
+			}
+		}
+	}
+
+}
+
+func TestNormalizeWhitespace(t *testing.T) {
+	// The default options of SentencePiece's normalizer.
+	spm := Normalizer{addDummyPrefix: true, removeExtraWhitespaces: true, escapeWhitespaces: true}
+	suffix := spm
+	suffix.treatWhitespaceAsSuffix = true
+	unescaped := spm
+	unescaped.escapeWhitespaces = false
+
+	var tests = []struct {
+		name          string
+		n             Normalizer
+		text          string
+		want          string
+		wantAlignment []int
+	}{
+		{"default", spm, "  hello   world  ", "▁hello▁world", nil},
+		{"default", spm, " a  b ", "▁a▁b", []int{1, 1, 1, 1, 2, 2, 2, 4, 6}},
+		{"default", spm, "   ", "", []int{3}},
+		{"default", spm, "", "", []int{0}},
+		{"suffix", suffix, "  hello   world  ", "hello▁world▁", nil},
+		{"suffix", suffix, " a  b ", "a▁b▁", []int{1, 2, 2, 2, 4, 5, 5, 5, 6}},
+		{"suffix", suffix, "ab", "ab▁", []int{0, 1, 2, 2, 2, 2}},
+		{"unescaped", unescaped, "  hello   world▁ ", " hello world▁", nil},
+		{"dummy prefix only", Normalizer{addDummyPrefix: true, escapeWhitespaces: true}, " a  b ", "▁▁a▁▁b▁", nil},
+		{"remove extra only", Normalizer{removeExtraWhitespaces: true, escapeWhitespaces: true}, " a  b ", "a▁b", nil},
+		{"nothing", Normalizer{}, " a  b ", " a  b ", []int{0, 1, 2, 3, 4, 5, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, alignment := tt.n.NormalizeWithAlignment(tt.text)
+			if got != tt.want {
+				t.Errorf("NormalizeWithAlignment(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			if tt.wantAlignment != nil && !slices.Equal(alignment, tt.wantAlignment) {
+				t.Errorf("NormalizeWithAlignment(%q) alignment = %v, want %v", tt.text, alignment, tt.wantAlignment)
+			}
+			if len(alignment) != len(got)+1 || !slices.IsSorted(alignment) {
+				t.Errorf("got bad alignment %v for %q", alignment, got)
+			}
+			if normalized := tt.n.Normalize(tt.text); normalized != got {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.text, normalized, got)
+			}
+		})
+	}
+}
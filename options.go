@@ -0,0 +1,148 @@
+package sentencepiece
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/eliben/go-sentencepiece/internal/lru"
+	"github.com/eliben/go-sentencepiece/internal/model"
+)
+
+// Option configures optional behavior of a Processor. Options are passed to
+// the NewProcessor* constructors.
+type Option func(*Processor)
+
+// WithWordCache enables pre-tokenization with a cache of encoded words.
+//
+// With this option, Encode splits its (normalized) input into words at
+// whitespace separators, and encodes each word separately, caching the
+// tokens of up to size recently seen words. Since natural text repeats the
+// same words over and over, this can speed up encoding significantly.
+//
+// Words are only split at boundaries that the model's BPE merges can never
+// cross (this is determined from the model's vocabulary), so the results of
+// Encode are identical with and without this option. A size <= 0 disables
+// the cache.
+func WithWordCache(size int) Option {
+	return func(proc *Processor) {
+		if size > 0 {
+			proc.wordCache = lru.New[string, []Token](size)
+		} else {
+			proc.wordCache = nil
+		}
+	}
+}
+
+// WithMaxInputSize limits the size of the text (in bytes) that
+// [Processor.EncodeContext] accepts; longer text is rejected with a
+// [*LimitError] before any work is done. A size <= 0 means no limit, which is
+// the default. Encode is never limited.
+func WithMaxInputSize(size int) Option {
+	return func(proc *Processor) {
+		proc.maxInputSize = max(size, 0)
+	}
+}
+
+// WithMaxTokens limits the number of tokens [Processor.EncodeContext] may
+// return; if encoding produces more, it returns a [*LimitError] instead. A
+// count <= 0 means no limit, which is the default. Encode is never limited.
+func WithMaxTokens(count int) Option {
+	return func(proc *Processor) {
+		proc.maxTokens = max(count, 0)
+	}
+}
+
+// WithProtectedSymbols makes Encode treat each of symbols as an atomic unit,
+// like the user-defined pieces of the model: wherever a symbol appears in the
+// text, it's never split, or merged with its neighbors. This is useful for
+// strings like placeholders and template variables (e.g. "{{name}}").
+//
+// A symbol that's a piece of the model is encoded as that piece's token;
+// other symbols are encoded as the unknown token, or as byte tokens if the
+// model has byte fallback. The model itself isn't modified. Spaces in symbols
+// are matched like spaces in the text.
+func WithProtectedSymbols(symbols ...string) Option {
+	return func(proc *Processor) {
+		proc.protectedSymbols = append(proc.protectedSymbols, symbols...)
+	}
+}
+
+// WithDisabledSymbols makes Encode treat each of symbols, which are
+// user-defined pieces of the model, as ordinary text: it's neither matched as
+// an atomic unit, nor produced by merging smaller pieces, so text containing
+// it is encoded as smaller pieces instead. This is useful for encoding
+// untrusted text that must not produce special tokens, such as the turn
+// markers of chat templates.
+//
+// Symbols that aren't user-defined pieces of the model are ignored, as are
+// pieces of a single character, which can't be split further.
+func WithDisabledSymbols(symbols ...string) Option {
+	return func(proc *Processor) {
+		proc.disabledSymbols = append(proc.disabledSymbols, symbols...)
+	}
+}
+
+// WithVocabulary restricts Encode to a subset of the model's pieces, like
+// SetVocabulary in the SentencePiece C++ library: normal pieces that aren't
+// in pieces are never produced, and are split into smaller allowed pieces
+// instead. This emulates pruning the vocabulary (e.g. of pieces that are rare
+// in some corpus), to evaluate the effect before retraining the model.
+//
+// Pieces of a single character, and pieces that aren't of the normal type
+// (such as user-defined, control and byte pieces), are always allowed, so any
+// text can still be encoded. Strings in pieces that aren't in the vocabulary
+// are ignored. Piece frequencies as written by spm_encode
+// --generate_vocabulary can be read with [ReadVocab], to select the pieces
+// with a frequency above some threshold.
+func WithVocabulary(pieces []string) Option {
+	return func(proc *Processor) {
+		allowed := make(map[string]bool, len(pieces))
+		for _, p := range pieces {
+			allowed[p] = true
+		}
+		proc.restrictVocabulary(func(id int) bool {
+			return allowed[proc.model.pieceString(id)]
+		})
+	}
+}
+
+// WithVocabularyIDs is like [WithVocabulary], with the allowed pieces given
+// by their IDs. IDs out of the vocabulary's range are ignored.
+func WithVocabularyIDs(ids []int) Option {
+	return func(proc *Processor) {
+		allowed := make(map[int]bool, len(ids))
+		for _, id := range ids {
+			allowed[id] = true
+		}
+		proc.restrictVocabulary(func(id int) bool {
+			return allowed[id]
+		})
+	}
+}
+
+// restrictVocabulary sets proc.allowedIDs to the pieces for which allowed
+// returns true, along with the pieces that are always allowed; see
+// [WithVocabulary].
+func (proc *Processor) restrictVocabulary(allowed func(id int) bool) {
+	m := proc.model
+	proc.allowedIDs = make([]bool, m.numPieces())
+	for id := range proc.allowedIDs {
+		proc.allowedIDs[id] = m.pieceType(id) != model.ModelProto_SentencePiece_NORMAL ||
+			utf8.RuneCountInString(m.pieceString(id)) == 1 || allowed(id)
+	}
+}
+
+// LimitError is returned by [Processor.EncodeContext] when its input exceeds
+// one of the limits configured with [WithMaxInputSize] or [WithMaxTokens].
+type LimitError struct {
+	// Limit names the limit that was exceeded: "input size" or "token count".
+	Limit string
+
+	// Max is the configured limit, and Size is the actual value that
+	// exceeded it.
+	Max, Size int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s %d exceeds limit %d", e.Limit, e.Size, e.Max)
+}
@@ -0,0 +1,155 @@
+package sentencepiece
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/eliben/go-sentencepiece/internal/model"
+)
+
+// Pre-tokenization splits the symbol list of Encode into words, which are
+// encoded separately (see [WithWordCache]).
+//
+// A word boundary is placed before every symbol that begins with the
+// whitespace separator, unless a BPE merge could cross it. A merge crosses
+// the boundary between symbols L and R only if it produces a piece that has
+// the separator (R's first rune) right after L's last rune; so the boundary
+// is safe unless L's last rune is one of the runes that precede a separator
+// within some piece of the model. Boundaries are also placed around
+// user-defined symbols, which never merge with their neighbors.
+//
+// For models that treat whitespace as a suffix, words end with the separator
+// instead: a boundary is placed after every symbol that ends with it, unless
+// R's first rune is one of the runes that follow a separator within some
+// piece. The separator is a space for models that don't escape whitespace.
+//
+// User-defined pieces disabled with [WithDisabledSymbols] can be produced by
+// merges, so the runes next to their separators are taken into account too.
+
+// encodeWords encodes symList (the initial symbols of text, as produced by
+// Encode) word by word, using the processor's word cache. It fails only if ctx
+// is done.
+func (proc *Processor) encodeWords(ctx context.Context, text string, symList []symListElem) ([]Token, error) {
+	noSplit := proc.noSplit
+	space := proc.model.normalizer.whitespace()
+	suffix := proc.model.normalizer.treatWhitespaceAsSuffix
+
+	isBoundary := func(prev, cur symListElem) bool {
+		if prev.noMerge || cur.noMerge {
+			return true
+		}
+		if suffix {
+			if !strings.HasSuffix(prev.symbol, space) {
+				return false
+			}
+			r, _ := utf8.DecodeRuneInString(cur.symbol)
+			return !noSplit[r]
+		}
+		if !strings.HasPrefix(cur.symbol, space) {
+			return false
+		}
+		r, _ := utf8.DecodeLastRuneInString(prev.symbol)
+		return !noSplit[r]
+	}
+
+	var tokens []Token
+	var scratch []symListElem
+	wordStart, wordOffset, offset := 0, 0, 0
+	numWords := 0
+	for i := range symList {
+		if i > 0 && isBoundary(symList[i-1], symList[i]) {
+			var err error
+			tokens, err = proc.encodeWord(ctx, text[wordOffset:offset], symList[wordStart:i], &scratch, tokens)
+			if err != nil {
+				return nil, err
+			}
+			wordStart, wordOffset = i, offset
+
+			if numWords++; numWords%cancelCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		offset += len(symList[i].symbol)
+	}
+	return proc.encodeWord(ctx, text[wordOffset:], symList[wordStart:], &scratch, tokens)
+}
+
+// encodeWord encodes the symbols of a single word, appending the resulting
+// tokens to tokens. scratch is a reusable buffer for the symbol list.
+func (proc *Processor) encodeWord(ctx context.Context, word string, syms []symListElem, scratch *[]symListElem, tokens []Token) ([]Token, error) {
+	if cached, ok := proc.wordCache.Get(word); ok {
+		return append(tokens, cached...), nil
+	}
+
+	*scratch = append((*scratch)[:0], syms...)
+	wordList := *scratch
+	for i := range wordList {
+		wordList[i].prev = i - 1
+		wordList[i].next = i + 1
+	}
+	wordList[len(wordList)-1].next = -1
+
+	n := len(tokens)
+	tokens, err := proc.mergeSymbols(ctx, wordList, tokens)
+	if err != nil {
+		return nil, err
+	}
+	proc.wordCache.Add(strings.Clone(word), proc.detachTokens(tokens[n:]))
+	return tokens, nil
+}
+
+// detachTokens returns a copy of tokens suitable for caching: token texts that
+// are slices of the input (rather than of the model's pieces) are cloned, so
+// that the cache doesn't keep the input alive.
+func (proc *Processor) detachTokens(tokens []Token) []Token {
+	detached := make([]Token, len(tokens))
+	for i, t := range tokens {
+		if piece := proc.model.pieceString(t.ID); piece == t.Text {
+			t.Text = piece
+		} else {
+			t.Text = strings.Clone(t.Text)
+		}
+		detached[i] = t
+	}
+	return detached
+}
+
+// noSplitRunes returns the set of runes that precede a whitespace separator
+// (or follow it, for models that treat whitespace as a suffix) within some
+// piece that merges can produce.
+func (m *Model) noSplitRunes() map[rune]bool {
+	m.noSplitOnce.Do(func() {
+		m.noSplit = make(map[rune]bool)
+		for id := range m.numPieces() {
+			// User-defined pieces are only ever matched as a whole, never
+			// produced by merges.
+			if t := m.pieceType(id); !isNormalPieceType(t) || t == model.ModelProto_SentencePiece_USER_DEFINED {
+				continue
+			}
+			m.addNoSplitRunes(m.noSplit, m.pieceString(id))
+		}
+	})
+	return m.noSplit
+}
+
+// addNoSplitRunes adds the runes next to the whitespace separators within
+// piece to noSplit; see noSplitRunes.
+func (m *Model) addNoSplitRunes(noSplit map[rune]bool, piece string) {
+	space := m.normalizer.whitespace()
+	suffix := m.normalizer.treatWhitespaceAsSuffix
+	for i := 0; i < len(piece); i++ {
+		if !strings.HasPrefix(piece[i:], space) {
+			continue
+		}
+		if suffix && i+len(space) < len(piece) {
+			r, _ := utf8.DecodeRuneInString(piece[i+len(space):])
+			noSplit[r] = true
+		} else if !suffix && i > 0 {
+			r, _ := utf8.DecodeLastRuneInString(piece[:i])
+			noSplit[r] = true
+		}
+	}
+}
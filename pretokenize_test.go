@@ -0,0 +1,92 @@
+package sentencepiece
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWordCacheIdenticalOutput(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("test", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts := []string{
+		"",
+		" ",
+		"   ",
+		"hello world",
+		"  hello   world  ",
+		sampleText,
+		strings.Repeat(sampleText, 3),
+	}
+	for _, path := range paths {
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		texts = append(texts, string(buf))
+	}
+
+	proc := createProcessor(t)
+	m := proc.Model()
+
+	// A tiny cache exercises eviction; a large one exercises hits.
+	for _, size := range []int{1, 16, 100000} {
+		cachedProc := NewProcessorFromModel(m, WithWordCache(size))
+
+		// Run twice, to check the results with a cold and a warm cache.
+		for round := range 2 {
+			for i, text := range texts {
+				want := proc.Encode(text)
+				got := cachedProc.Encode(text)
+				if !slices.Equal(got, want) {
+					t.Errorf("size %d, round %d, text #%d: Encode results differ", size, round, i)
+				}
+			}
+		}
+	}
+}
+
+func TestWordCacheDisabledSymbols(t *testing.T) {
+	// The disabled user-defined piece "qq▁q" is produced by merges (and then
+	// split into "qq" and "▁q"), so a word boundary can't be placed between
+	// "qq" and "▁qj".
+	vocab := []PieceInfo{
+		{ID: 0, Piece: "<unk>", Type: "UNKNOWN"},
+		{ID: 1, Piece: "▁q", Score: -1},
+		{ID: 2, Piece: "qq", Score: -2},
+		{ID: 3, Piece: "qq▁q", Type: "USER_DEFINED"},
+		{ID: 4, Piece: "▁qj", Score: -4},
+		{ID: 5, Piece: "q", Score: -10},
+		{ID: 6, Piece: "j", Score: -11},
+		{ID: 7, Piece: "▁", Score: -12},
+	}
+	data, err := BuildModelProto(vocab, []byte("trainer_spec { model_type: BPE } normalizer_spec { add_dummy_prefix: false }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadModelFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := "qq qj"
+	want := NewProcessorFromModel(m, WithDisabledSymbols("qq▁q")).Encode(text)
+	got := NewProcessorFromModel(m, WithDisabledSymbols("qq▁q"), WithWordCache(100)).Encode(text)
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestWordCacheDisabled(t *testing.T) {
+	proc := createProcessor(t)
+	for _, size := range []int{0, -1} {
+		p := NewProcessorFromModel(proc.Model(), WithWordCache(size))
+		if p.wordCache != nil {
+			t.Errorf("size %d: got word cache, want none", size)
+		}
+	}
+}
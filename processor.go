@@ -1,17 +1,21 @@
 package sentencepiece
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"os"
+	"io/fs"
+	"maps"
+	"slices"
 	"strconv"
 	"strings"
 	"unicode/utf8"
 
+	"github.com/eliben/go-sentencepiece/internal/doublearray"
+	"github.com/eliben/go-sentencepiece/internal/lru"
 	"github.com/eliben/go-sentencepiece/internal/model"
 	"github.com/eliben/go-sentencepiece/internal/prefixmatcher"
 	"github.com/eliben/go-sentencepiece/internal/priorityqueue"
-	"google.golang.org/protobuf/proto"
 )
 
 const debugEncode = false
@@ -25,131 +29,191 @@ const debugEncode = false
 // The term "processor" comes from the original C++ SentencePiece library and
 // its Python bindings.
 type Processor struct {
-	model *model.ModelProto
-
-	pieces   map[string]int
-	reserved map[string]int
-
-	// unknownID is the token identifier of the UNKNOWN piece
-	unknownID int
-
-	// userDefinedMatcher is a prefix matcher for symbols that are of
-	// "user-defined" type in the model proto.
+	model *Model
+
+	// wordCache caches the tokens of words when pre-tokenization is enabled;
+	// see [WithWordCache].
+	wordCache *lru.Cache[string, []Token]
+
+	// maxInputSize and maxTokens are the limits enforced by EncodeContext, or
+	// 0 for no limit; see [WithMaxInputSize] and [WithMaxTokens].
+	maxInputSize int
+	maxTokens    int
+
+	// protectedSymbols and disabledSymbols are the symbols set with
+	// [WithProtectedSymbols] and [WithDisabledSymbols]. userDefinedMatcher
+	// matches the protected symbols along with the model's user-defined
+	// pieces, except the disabled ones; without protected or disabled symbols,
+	// it's the model's matcher.
+	protectedSymbols   []string
+	disabledSymbols    []string
 	userDefinedMatcher *prefixmatcher.PrefixMatcher
 
-	// byte2Token is a cache of byte values and the tokens they represent
-	byte2Token map[byte]Token
+	// normalizer applies the model's normalization rules, keeping the symbols
+	// of userDefinedMatcher verbatim.
+	normalizer *Normalizer
 
-	// idToByte maps IDs to byte values they represent
-	idToByte map[int]byte
+	// allowedIDs is the restricted vocabulary set with [WithVocabulary] (less
+	// the pieces disabled with [WithDisabledSymbols]), indexed by piece ID;
+	// nil means all pieces are allowed.
+	allowedIDs []bool
 
-	// maxPieceLength is the maximum length of a piece in the model.
-	// This is used to preallocate a buffer for merging symbols.
-	maxPieceLength int
+	// noSplit is the set of runes next to which pre-tokenization can't split
+	// words (see noSplitRunes), including those of the disabled pieces; it's
+	// only set when there's a word cache.
+	noSplit map[rune]bool
 }
 
 // NewProcessorFromPath creates a new Processor from a file path to the protobuf
 // data.
-func NewProcessorFromPath(protoFile string) (*Processor, error) {
-	f, err := os.Open(protoFile)
+func NewProcessorFromPath(protoFile string, opts ...Option) (*Processor, error) {
+	m, err := LoadModelFromPath(protoFile)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read %q: %v", protoFile, err)
+		return nil, err
 	}
-	defer f.Close()
-	return NewProcessor(f)
+	return NewProcessorFromModel(m, opts...), nil
 }
 
 // NewProcessor creates a new Processor from a reader with the protobuf data.
-func NewProcessor(protoReader io.Reader) (*Processor, error) {
-	b, err := io.ReadAll(protoReader)
+func NewProcessor(protoReader io.Reader, opts ...Option) (*Processor, error) {
+	m, err := LoadModel(protoReader)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read protobuf data: %v", err)
+		return nil, err
 	}
+	return NewProcessorFromModel(m, opts...), nil
+}
 
-	var mp model.ModelProto
-	err = proto.Unmarshal(b, &mp)
+// NewProcessorFromBytes creates a new Processor from the protobuf data in b.
+// See [LoadModelFromBytes].
+func NewProcessorFromBytes(b []byte, opts ...Option) (*Processor, error) {
+	m, err := LoadModelFromBytes(b)
 	if err != nil {
-		return nil, fmt.Errorf("unable to unmarshal protobuf: %v", err)
+		return nil, err
 	}
+	return NewProcessorFromModel(m, opts...), nil
+}
 
-	tspec := mp.GetTrainerSpec()
-	if tspec.GetModelType() != model.TrainerSpec_BPE {
-		return nil, fmt.Errorf("model type %s not supported", tspec.GetModelType())
+// NewProcessorFromFS creates a new Processor from the protobuf data in file
+// name of fsys. See [LoadModelFromFS].
+func NewProcessorFromFS(fsys fs.FS, name string, opts ...Option) (*Processor, error) {
+	m, err := LoadModelFromFS(fsys, name)
+	if err != nil {
+		return nil, err
 	}
+	return NewProcessorFromModel(m, opts...), nil
+}
 
-	nspec := mp.GetNormalizerSpec()
-	if *nspec.AddDummyPrefix || *nspec.RemoveExtraWhitespaces {
-		return nil, fmt.Errorf("normalizer spec options not supported: %s", nspec)
+// NewProcessorFromMmap creates a new Processor from a file path to the
+// protobuf data, which is memory-mapped. See [LoadModelMmap].
+func NewProcessorFromMmap(protoFile string, opts ...Option) (*Processor, error) {
+	m, err := LoadModelMmap(protoFile)
+	if err != nil {
+		return nil, err
 	}
+	return NewProcessorFromModel(m, opts...), nil
+}
 
-	userDefined := make(map[string]bool)
-	pieces := make(map[string]int)
-	reserved := make(map[string]int)
-	byte2Token := make(map[byte]Token)
-	idToByte := make(map[int]byte)
-	unkID := -1
-	maxPieceLength := 0
-
-	for i, piece := range mp.GetPieces() {
-		isNormalPiece := (piece.GetType() == model.ModelProto_SentencePiece_NORMAL ||
-			piece.GetType() == model.ModelProto_SentencePiece_USER_DEFINED ||
-			piece.GetType() == model.ModelProto_SentencePiece_UNUSED)
-
-		if isNormalPiece {
-			pieces[piece.GetPiece()] = i
-			maxPieceLength = max(maxPieceLength, len(piece.GetPiece()))
-		} else {
-			reserved[piece.GetPiece()] = i
-		}
+// NewProcessorFromModel creates a new Processor from a loaded Model. The
+// model is shared, not copied; it's safe to create many Processors from the
+// same Model, with different options.
+func NewProcessorFromModel(m *Model, opts ...Option) *Processor {
+	proc := &Processor{model: m}
+	for _, opt := range opts {
+		opt(proc)
+	}
 
-		if piece.GetType() == model.ModelProto_SentencePiece_USER_DEFINED {
-			userDefined[piece.GetPiece()] = true
-		} else if piece.GetType() == model.ModelProto_SentencePiece_UNKNOWN {
-			if unkID > 0 {
-				return nil, fmt.Errorf("unk redefined")
+	proc.userDefinedMatcher = m.userDefinedMatcher
+	proc.normalizer = m.normalizer
+	var disabledPieces []string
+	if len(proc.protectedSymbols) > 0 || len(proc.disabledSymbols) > 0 {
+		symbols := m.userDefinedSymbols()
+		for _, sym := range proc.protectedSymbols {
+			if sym != "" {
+				symbols[m.normalizer.escape(sym)] = true
 			}
-			unkID = i
-		} else if piece.GetType() == model.ModelProto_SentencePiece_BYTE {
-			if !tspec.GetByteFallback() {
-				return nil, fmt.Errorf("byte piece %q is found although `byte_fallback=false`", piece.GetPiece())
+		}
+		for _, sym := range proc.disabledSymbols {
+			id, ok := m.lookupPiece(m.normalTrie, sym)
+			if !ok || m.pieceType(id) != model.ModelProto_SentencePiece_USER_DEFINED ||
+				utf8.RuneCountInString(sym) == 1 {
+				continue
 			}
-			bv := convertHexValue(piece.GetPiece())
-			if bv >= 0 && bv < 256 {
-				byte2Token[byte(bv)] = Token{ID: i, Text: piece.GetPiece()}
-				idToByte[i] = byte(bv)
+			delete(symbols, sym)
+			disabledPieces = append(disabledPieces, sym)
+			if proc.allowedIDs == nil {
+				proc.allowedIDs = make([]bool, m.numPieces())
+				for i := range proc.allowedIDs {
+					proc.allowedIDs[i] = true
+				}
 			}
+			proc.allowedIDs[id] = false
 		}
+		proc.userDefinedMatcher = prefixmatcher.NewFromSet(symbols)
+		proc.normalizer = m.normalizer.withSymbols(symbols)
 	}
-
-	if unkID < 0 {
-		return nil, fmt.Errorf("unk symbol is not defined")
-	}
-
-	// In case byte_fallback is specified, make sure that all 256 possible byte
-	// values were found.
-	if tspec.GetByteFallback() {
-		for i := 0; i < 256; i++ {
-			if _, found := byte2Token[byte(i)]; !found {
-				return nil, fmt.Errorf("byte value 0x%02X not found", i)
+	if proc.wordCache != nil {
+		proc.noSplit = m.noSplitRunes()
+		if len(disabledPieces) > 0 {
+			proc.noSplit = maps.Clone(proc.noSplit)
+			for _, piece := range disabledPieces {
+				m.addNoSplitRunes(proc.noSplit, piece)
 			}
 		}
 	}
+	return proc
+}
+
+// Model returns the Model this processor was created from.
+func (proc *Processor) Model() *Model {
+	return proc.model
+}
 
-	return &Processor{
-		model:              &mp,
-		userDefinedMatcher: prefixmatcher.NewFromSet(userDefined),
-		byte2Token:         byte2Token,
-		idToByte:           idToByte,
-		unknownID:          unkID,
-		pieces:             pieces,
-		reserved:           reserved,
-		maxPieceLength:     maxPieceLength,
-	}, nil
+// Normalizer returns a Normalizer that normalizes text exactly like Encode
+// does before tokenizing it. It differs from the model's Normalizer only if
+// the processor has protected or disabled symbols (see
+// [WithProtectedSymbols]), which change the symbols that are kept verbatim.
+func (proc *Processor) Normalizer() *Normalizer {
+	return proc.normalizer
 }
 
 // Encode tokenizes the input text and returns a list of Tokens.
 func (proc *Processor) Encode(text string) []Token {
-	text = normalize(text)
+	// encode only fails when the context is done, which can't happen here.
+	tokens, _ := proc.encode(context.Background(), text)
+	return tokens
+}
+
+// EncodeContext is like Encode, but it stops early and returns ctx.Err() if
+// ctx is done while encoding. It also enforces the limits configured with
+// [WithMaxInputSize] and [WithMaxTokens], returning a [*LimitError] if the
+// text exceeds them.
+func (proc *Processor) EncodeContext(ctx context.Context, text string) ([]Token, error) {
+	if proc.maxInputSize > 0 && len(text) > proc.maxInputSize {
+		return nil, &LimitError{Limit: "input size", Max: proc.maxInputSize, Size: len(text)}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	tokens, err := proc.encode(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	if proc.maxTokens > 0 && len(tokens) > proc.maxTokens {
+		return nil, &LimitError{Limit: "token count", Max: proc.maxTokens, Size: len(tokens)}
+	}
+	return tokens, nil
+}
+
+// cancelCheckInterval is the number of steps (symbols, merges or words)
+// encoding takes between checks of its context.
+const cancelCheckInterval = 4096
+
+// encode implements Encode and EncodeContext; the only error it returns is
+// ctx.Err().
+func (proc *Processor) encode(ctx context.Context, text string) ([]Token, error) {
+	text, _ = proc.normalizer.normalize(text, false)
+	normText := text
 
 	// We begin by having each symbol a single Unicode character (or a
 	// user-defined string), and will iteratively merge them into larger and
@@ -158,17 +222,16 @@ func (proc *Processor) Encode(text string) []Token {
 	// doubly-linked list in the symList slice. Each element in this slice has
 	// prev/next links to the next "live" symbol in the list; noMerge means this
 	// is a user-defined symbol we're not allowed to merge with neighbors.
+	// Each element also keeps the node its symbol leads to in the trie of the
+	// model's pieces, which lets us look up merged symbols without
+	// concatenating them.
 	// After the algorithm is finished, many elements in symList will be "dead"
 	// (unreachable by next/prev links from the first element).
 	// This representation is inspired by the implementation of bpe::Model
 	// in the SentencePiece C++ library.
 
-	type symListElem struct {
-		prev, next int
-		noMerge    bool
-		symbol     string
-	}
 	symList := make([]symListElem, 0, len(text))
+	trie := proc.model.normalTrie
 
 	for {
 		// Match the next symbol in text
@@ -181,8 +244,19 @@ func (proc *Processor) Encode(text string) []Token {
 			symbol:  text[:slen],
 			prev:    len(symList) - 1,
 			next:    len(symList) + 1,
+			node:    -1,
+		}
+		if !found {
+			if node, ok := trie.Walk(doublearray.Root, sym.symbol); ok {
+				sym.node = node
+			}
 		}
 		symList = append(symList, sym)
+		if len(symList)%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
 
 		// Advance the text slice to the next symbol; if no more text, we're done.
 		text = text[slen:]
@@ -192,9 +266,37 @@ func (proc *Processor) Encode(text string) []Token {
 	}
 
 	if len(symList) == 0 {
-		return nil
+		return nil, nil
 	}
 	symList[len(symList)-1].next = -1
+
+	switch proc.model.proto.GetTrainerSpec().GetModelType() {
+	case model.TrainerSpec_CHAR:
+		return proc.encodeChars(symList), nil
+	case model.TrainerSpec_WORD:
+		return proc.encodeWordModel(normText, symList), nil
+	}
+	if proc.wordCache != nil {
+		return proc.encodeWords(ctx, normText, symList)
+	}
+	return proc.mergeSymbols(ctx, symList, nil)
+}
+
+// symListElem is an element of the symbol list Encode works on; see the
+// comment in [Encode] for details.
+type symListElem struct {
+	prev, next int
+	noMerge    bool
+	symbol     string
+	node       doublearray.Node
+}
+
+// mergeSymbols runs the BPE merge algorithm on the symbols in symList, whose
+// prev/next links must be set up to form a list starting at index 0. The
+// resulting tokens are appended to tokens, and the updated slice is returned.
+// It fails only if ctx is done.
+func (proc *Processor) mergeSymbols(ctx context.Context, symList []symListElem, tokens []Token) ([]Token, error) {
+	trie := proc.model.normalTrie
 	nTokens := len(symList)
 
 	debugShowSymList := func(prefix string) {
@@ -225,18 +327,21 @@ func (proc *Processor) Encode(text string) []Token {
 		return -1
 	})
 
-	// findMerged looks for x+y in the vocabulary, and returns the
-	// merged piece, its ID and true if found. buf is a reusable buffer used to
-	// merge two strings together without allocations.
-	buf := make([]byte, proc.maxPieceLength)
-	findMerged := func(x, y symListElem) (string, int, bool) {
-		buf = buf[:len(x.symbol)+len(y.symbol)]
-		copy(buf, x.symbol)
-		copy(buf[len(x.symbol):], y.symbol)
-		if id, found := proc.pieces[string(buf)]; found {
-			return proc.model.GetPieces()[id].GetPiece(), id, true
+	// findMerged looks for x+y in the vocabulary, and returns the trie node of
+	// the merged piece, its ID and true if found. Since x's trie node is
+	// known, this only has to walk the trie through y's bytes.
+	findMerged := func(x, y symListElem) (doublearray.Node, int, bool) {
+		if x.node < 0 {
+			return 0, 0, false
+		}
+		node, ok := trie.Walk(x.node, y.symbol)
+		if !ok {
+			return 0, 0, false
+		}
+		if id, found := proc.model.nodePiece(trie, node); found {
+			return node, id, true
 		}
-		return "", 0, false
+		return 0, 0, false
 	}
 
 	// suggestNewMergePair is called to potentially add a new mergeCandidate to
@@ -247,12 +352,12 @@ func (proc *Processor) Encode(text string) []Token {
 			return
 		}
 
-		if mergedSymbol, id, ok := findMerged(symList[left], symList[right]); ok {
+		if _, id, ok := findMerged(symList[left], symList[right]); ok {
 			mergeQueue.Insert(mergeCandidate{
 				left:   left,
 				right:  right,
-				length: len(mergedSymbol),
-				score:  proc.model.GetPieces()[id].GetScore(),
+				length: len(symList[left].symbol) + len(symList[right].symbol),
+				score:  proc.model.pieceScores[id],
 			})
 		}
 	}
@@ -271,9 +376,22 @@ func (proc *Processor) Encode(text string) []Token {
 		return leftSymbol == "" || rightSymbol == "" || len(leftSymbol)+len(rightSymbol) != candidate.length
 	}
 
+	// unusedMerges records the parts that pieces outside the restricted
+	// vocabulary (see [WithVocabulary]) were merged from. Such pieces are
+	// merged like any other, since allowed pieces may be built from them, and
+	// are split back into their parts when collecting the final tokens. This
+	// is the resegmentation done by the C++ library for unused pieces.
+	var unusedMerges map[string][2]string
+
 	// Main loop
 	mergeQueueDead := 0
-	for mergeQueue.Len() > 0 {
+	for step := 1; mergeQueue.Len() > 0; step++ {
+		if step%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
 		candidate := mergeQueue.PopMax()
 		leftSymbol := symList[candidate.left]
 		rightSymbol := symList[candidate.right]
@@ -295,11 +413,18 @@ func (proc *Processor) Encode(text string) []Token {
 
 		// Do the merge:
 		// 1. Merge the concatenation of leftSymbol and rightSymbol into leftSymbol
-		mergedSymbol, _, ok := findMerged(leftSymbol, rightSymbol)
+		mergedNode, mergedID, ok := findMerged(leftSymbol, rightSymbol)
 		if !ok {
 			panic("failed to merge symbols")
 		}
-		symList[candidate.left].symbol = mergedSymbol
+		symList[candidate.left].symbol = proc.model.pieceString(mergedID)
+		symList[candidate.left].node = mergedNode
+		if proc.allowedIDs != nil && !proc.allowedIDs[mergedID] {
+			if unusedMerges == nil {
+				unusedMerges = make(map[string][2]string)
+			}
+			unusedMerges[symList[candidate.left].symbol] = [2]string{leftSymbol.symbol, rightSymbol.symbol}
+		}
 		nTokens--
 
 		// 2. Update prev/next pointers
@@ -318,24 +443,54 @@ func (proc *Processor) Encode(text string) []Token {
 		suggestNewMergePair(candidate.left, rightSymbol.next)
 	}
 
+	appendToken := func(symbol string) {
+		tokens = proc.appendSymbolToken(tokens, symbol)
+	}
+
+	// resegment appends the tokens for a merged symbol, splitting it into its
+	// parts (recursively) if it's an unused piece.
+	var resegment func(symbol string)
+	resegment = func(symbol string) {
+		if parts, ok := unusedMerges[symbol]; ok {
+			resegment(parts[0])
+			resegment(parts[1])
+		} else {
+			appendToken(symbol)
+		}
+	}
+
 	// Collect the final list of tokens from the remaining elements of symList.
-	tokens := make([]Token, 0, nTokens)
+	tokens = slices.Grow(tokens, nTokens)
 	for i := 0; i >= 0; i = symList[i].next {
-		symbol := symList[i].symbol
-		id := proc.symbolToID(symbol)
-
-		if id == proc.unknownID && proc.model.GetTrainerSpec().GetByteFallback() {
-			// Decompose this symbol into bytes, and report each byte as a separate
-			// token.
-			for i := 0; i < len(symbol); i++ {
-				tokens = append(tokens, proc.byte2Token[symbol[i]])
-			}
+		if symList[i].noMerge {
+			appendToken(symList[i].symbol)
 		} else {
-			tokens = append(tokens, Token{ID: id, Text: symbol})
+			resegment(symList[i].symbol)
 		}
 	}
 
-	return tokens
+	return tokens, nil
+}
+
+// appendSymbolToken appends the token for symbol to tokens, or its byte
+// tokens if it's unknown and the model has byte fallback, and returns the
+// updated slice.
+func (proc *Processor) appendSymbolToken(tokens []Token, symbol string) []Token {
+	return proc.appendTokenWithID(tokens, symbol, proc.symbolToID(symbol))
+}
+
+// appendTokenWithID is like appendSymbolToken, with the ID of symbol already
+// looked up.
+func (proc *Processor) appendTokenWithID(tokens []Token, symbol string, id int) []Token {
+	if id == proc.model.unknownID && proc.model.proto.GetTrainerSpec().GetByteFallback() {
+		// Decompose this symbol into bytes, and report each byte as a separate
+		// token.
+		for i := 0; i < len(symbol); i++ {
+			tokens = append(tokens, proc.model.byte2Token[symbol[i]])
+		}
+		return tokens
+	}
+	return append(tokens, Token{ID: id, Text: symbol})
 }
 
 // symbolMatch finds the length of the first symbol in text. A symbol is either
@@ -359,15 +514,12 @@ const (
 )
 
 // symbolToID finds the right ID for the given textual symbol, or returns
-// proc.unknownID if the symbol is unknown.
+// the model's unknown ID if the symbol is unknown.
 func (proc *Processor) symbolToID(symbol string) int {
-	if id, found := proc.reserved[symbol]; found {
+	if id, found := proc.PieceToID(symbol); found {
 		return id
 	}
-	if id, found := proc.pieces[symbol]; found {
-		return id
-	}
-	return proc.unknownID
+	return proc.model.unknownID
 }
 
 // convertHexValue converts strings of the form "<0xXY>" to the (unsigned)
@@ -383,9 +535,126 @@ func convertHexValue(bv string) int {
 }
 
 // Decode translates a list of IDs produced by [Encode] back into the string
-// it represents.
+// it represents. The dummy space the model's normalizer adds to the start (or
+// end) of text is removed. If the model's denormalizer spec has rules (a
+// precompiled charsmap or a rule TSV), they're applied to the decoded text.
 func (proc *Processor) Decode(ids []int) string {
+	text, _ := proc.decode(ids, nil, DecodeOptions{})
+	return text
+}
+
+// Span is a range of bytes in a text: text[Start:End].
+type Span struct {
+	Start, End int
+}
+
+// DecodeWithSpans is like [Processor.Decode], but also returns the span of
+// the decoded text that each of ids produced; spans[i] is the span of ids[i].
+// This maps parts of the text back to the tokens they came from, e.g. for
+// highlighting or attribution of generated text.
+//
+// The spans are in order, and don't overlap, with these exceptions: control
+// tokens have empty spans (at the position they appear in). Byte tokens whose
+// bytes combine into a single rune all have the span of that rune. The span
+// of the unknown token covers the model's unk_surface text. When a
+// denormalizer rule replaces text produced by several tokens, the first of
+// them gets the span of the replacement, and the others get empty spans.
+func (proc *Processor) DecodeWithSpans(ids []int) (string, []Span) {
+	spans := make([]Span, len(ids))
+	text, _ := proc.decode(ids, spans, DecodeOptions{})
+	return text, spans
+}
+
+// DecodeOptions configures [Processor.DecodeWithOptions]. The zero value
+// decodes like [Processor.Decode].
+type DecodeOptions struct {
+	// ShowControl renders control tokens as their piece text (e.g. "<eos>"),
+	// instead of dropping them.
+	ShowControl bool
+
+	// UnknownSurface points to the text the unknown token is rendered as,
+	// which may be empty to drop unknown tokens; if it's nil, the model's
+	// unk_surface is used.
+	UnknownSurface *string
+
+	// InvalidUTF8 selects what happens with byte tokens that don't combine
+	// into valid UTF-8.
+	InvalidUTF8 InvalidUTF8Mode
+}
+
+// InvalidUTF8Mode is a way of handling invalid UTF-8 from byte tokens; see
+// [DecodeOptions].
+type InvalidUTF8Mode int
+
+const (
+	// ReplaceInvalidUTF8 renders each invalid byte as the replacement
+	// character U+FFFD, like SentencePiece does.
+	ReplaceInvalidUTF8 InvalidUTF8Mode = iota
+
+	// SkipInvalidUTF8 drops invalid bytes.
+	SkipInvalidUTF8
+
+	// ErrorOnInvalidUTF8 makes decoding fail with an [*InvalidUTF8Error].
+	ErrorOnInvalidUTF8
+)
+
+// InvalidUTF8Error is returned by [Processor.DecodeWithOptions] for byte
+// tokens that don't combine into valid UTF-8, with [ErrorOnInvalidUTF8].
+type InvalidUTF8Error struct {
+	// Index is the index of the first invalid byte token in the IDs, and ID
+	// is its ID.
+	Index, ID int
+}
+
+func (e *InvalidUTF8Error) Error() string {
+	return fmt.Sprintf("invalid UTF-8 from byte token %d at index %d", e.ID, e.Index)
+}
+
+// InvalidIDError is returned by [Processor.DecodeWithOptions] and
+// [StreamDecoder.Decode] for IDs that are out of the vocabulary's range.
+type InvalidIDError struct {
+	// Index is the index of the first invalid ID in the IDs, and ID is its
+	// value.
+	Index, ID int
+}
+
+func (e *InvalidIDError) Error() string {
+	return fmt.Sprintf("invalid token ID %d at index %d", e.ID, e.Index)
+}
+
+// checkIDs returns an [*InvalidIDError] for the first of ids that's out of the
+// vocabulary's range, or nil if they're all valid.
+func (proc *Processor) checkIDs(ids []int) error {
+	for i, id := range ids {
+		if id < 0 || id >= proc.model.numPieces() {
+			return &InvalidIDError{Index: i, ID: id}
+		}
+	}
+	return nil
+}
+
+// DecodeWithOptions is like [Processor.Decode], with the behavior for
+// control tokens, unknown tokens and invalid UTF-8 configured by opts. It
+// fails with an [*InvalidIDError] if some ID is out of the vocabulary's range,
+// and with an [*InvalidUTF8Error] for invalid UTF-8 with
+// [ErrorOnInvalidUTF8].
+func (proc *Processor) DecodeWithOptions(ids []int, opts DecodeOptions) (string, error) {
+	if err := proc.checkIDs(ids); err != nil {
+		return "", err
+	}
+	return proc.decode(ids, nil, opts)
+}
+
+// decode implements the Decode* methods; spans is nil, or has a span for each
+// of ids to fill in.
+func (proc *Processor) decode(ids []int, spans []Span, opts DecodeOptions) (string, error) {
+	unkSurface := proc.model.proto.GetTrainerSpec().GetUnkSurface()
+	if opts.UnknownSurface != nil {
+		unkSurface = *opts.UnknownSurface
+	}
+
 	var sb strings.Builder
+	dummy := proc.dummyWhitespaceIndex(ids)
 
 	for i := 0; i < len(ids); {
 		// Find a run of IDs that represent single bytes starting at i.
@@ -399,16 +668,34 @@ func (proc *Processor) Decode(ids []int) string {
 		if numBytes > 0 {
 			buf := make([]byte, 0, numBytes)
 			for bi := i; bi < nextNonByte; bi++ {
-				buf = append(buf, proc.idToByte[ids[bi]])
+				buf = append(buf, proc.model.idToByte[ids[bi]])
 			}
 
-			for len(buf) > 0 {
+			for bi := i; len(buf) > 0; {
 				// DecodeRune returns utf8.RuneError ('\uFFFD') for bad UTF8 encodings,
 				// and this is exactly what SentencePiece is supposed to emit for them.
 				// So we don't do any special handling for UTF8 decode errors here.
 				r, size := utf8.DecodeRune(buf)
-				sb.WriteRune(r)
+				start := sb.Len()
+				if r != utf8.RuneError || size != 1 {
+					sb.WriteRune(r)
+				} else {
+					switch opts.InvalidUTF8 {
+					case SkipInvalidUTF8:
+						// Drop the invalid byte
+					case ErrorOnInvalidUTF8:
+						return "", &InvalidUTF8Error{Index: bi, ID: ids[bi]}
+					default:
+						sb.WriteRune(r)
+					}
+				}
 				buf = buf[size:]
+				for ; size > 0; size-- {
+					if spans != nil {
+						spans[bi] = Span{start, sb.Len()}
+					}
+					bi++
+				}
 			}
 		}
 
@@ -417,19 +704,79 @@ func (proc *Processor) Decode(ids []int) string {
 		}
 		// Here nextNonByte is the index of an ID that's not a single byte.
 		id := ids[nextNonByte]
+		start := sb.Len()
 		if proc.isControlID(id) {
-			// Don't emit anything for control IDs
-		} else if id == proc.unknownID {
+			// Don't emit anything for control IDs, unless asked to
+			if opts.ShowControl {
+				sb.WriteString(proc.model.pieceString(id))
+			}
+		} else if id == proc.model.unknownID {
 			// Special "unk_surface" string for unknown IDs
-			sb.WriteString(proc.model.GetTrainerSpec().GetUnkSurface())
+			sb.WriteString(unkSurface)
 		} else {
-			piece := proc.model.GetPieces()[id].GetPiece()
-			sb.WriteString(replaceSeparatorsBySpace(piece))
+			sb.WriteString(proc.pieceSurface(id, nextNonByte == dummy))
+		}
+		if spans != nil {
+			spans[nextNonByte] = Span{start, sb.Len()}
 		}
 		i = nextNonByte + 1
 	}
 
-	return sb.String()
+	if proc.model.denormalizer == nil {
+		return sb.String(), nil
+	}
+
+	// Apply the denormalizer rules to the decoded text, and move the spans to
+	// the denormalized text: an offset in the decoded text maps to the first
+	// byte produced from it or from text after it.
+	text, alignment := proc.model.denormalizer.NormalizeWithAlignment(sb.String())
+	for i := range spans {
+		spans[i].Start, _ = slices.BinarySearch(alignment, spans[i].Start)
+		spans[i].End, _ = slices.BinarySearch(alignment, spans[i].End)
+	}
+	return text, nil
+}
+
+// pieceSurface returns the text a normal (or user-defined) piece decodes to,
+// with the model's whitespace replaced by spaces; if trimDummy is true, the
+// dummy whitespace the normalizer adds to text is removed.
+func (proc *Processor) pieceSurface(id int, trimDummy bool) string {
+	piece := proc.model.pieceString(id)
+	if trimDummy {
+		piece = proc.model.normalizer.trimDummyWhitespace(piece)
+	}
+	return proc.model.normalizer.unescape(piece)
+}
+
+// dummyWhitespaceIndex returns the index in ids of the token whose piece has
+// the dummy whitespace the normalizer added when encoding, which decoding
+// removes: the first token that isn't a control token, or the last one for
+// models that treat whitespace as a suffix, if it's a piece that starts (or
+// ends) with whitespace. It returns -1 if there's no such token.
+func (proc *Processor) dummyWhitespaceIndex(ids []int) int {
+	n := proc.model.normalizer
+	if !n.hasDummyWhitespace() {
+		return -1
+	}
+	i, step := 0, 1
+	if n.treatWhitespaceAsSuffix {
+		i, step = len(ids)-1, -1
+	}
+	for ; i >= 0 && i < len(ids); i += step {
+		if proc.isControlID(ids[i]) {
+			continue
+		}
+		if proc.isByteID(ids[i]) || ids[i] == proc.model.unknownID {
+			return -1
+		}
+		piece := proc.model.pieceString(ids[i])
+		if n.treatWhitespaceAsSuffix && strings.HasSuffix(piece, n.whitespace()) ||
+			!n.treatWhitespaceAsSuffix && strings.HasPrefix(piece, n.whitespace()) {
+			return i
+		}
+		return -1
+	}
+	return -1
 }
 
 // DecodeTokens is a convenience wrapper around [Decode], accepting a list of
@@ -444,11 +791,30 @@ func (proc *Processor) DecodeTokens(tokens []Token) string {
 }
 
 func (proc *Processor) isByteID(id int) bool {
-	return proc.model.GetPieces()[id].GetType() == model.ModelProto_SentencePiece_BYTE
+	return proc.model.pieceType(id) == model.ModelProto_SentencePiece_BYTE
 }
 
 func (proc *Processor) isControlID(id int) bool {
-	return proc.model.GetPieces()[id].GetType() == model.ModelProto_SentencePiece_CONTROL
+	return proc.model.pieceType(id) == model.ModelProto_SentencePiece_CONTROL
+}
+
+// IDToPiece returns the text of the piece with the given ID, and true; or
+// false if id is out of range. The text is the piece as it appears in the
+// model's vocabulary, with whitespace separators ("▁") rather than spaces.
+func (proc *Processor) IDToPiece(id int) (string, bool) {
+	if id < 0 || id >= proc.model.numPieces() {
+		return "", false
+	}
+	return proc.model.pieceString(id), true
+}
+
+// PieceToID returns the ID of the piece with the given text, and true; or
+// false if there's no such piece in the model's vocabulary.
+func (proc *Processor) PieceToID(piece string) (int, bool) {
+	if id, found := proc.model.lookupPiece(proc.model.reservedTrie, piece); found {
+		return id, true
+	}
+	return proc.model.lookupPiece(proc.model.normalTrie, piece)
 }
 
 // ModelInfo stores information about the model proto loaded by the processor.
@@ -470,10 +836,10 @@ func (proc *Processor) ModelInfo() *ModelInfo {
 	}
 
 	return &ModelInfo{
-		VocabularySize:        len(proc.model.GetPieces()),
+		VocabularySize:        proc.model.numPieces(),
 		BeginningOfSentenceID: getControlID(symbolBOS),
 		EndOfSentenceID:       getControlID(symbolEOS),
 		PadID:                 getControlID(symbolPAD),
-		UnknownID:             proc.unknownID,
+		UnknownID:             proc.model.unknownID,
 	}
 }
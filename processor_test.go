@@ -1,20 +1,34 @@
 package sentencepiece
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"slices"
+	"strings"
 	"testing"
+	"unicode/utf8"
+
+	"github.com/eliben/go-sentencepiece/internal/charsmap"
+	"github.com/eliben/go-sentencepiece/internal/model"
+	"google.golang.org/protobuf/proto"
 )
 
-func createProcessor(t testing.TB) *Processor {
+// modelPath returns the path of the model proto the tests run against.
+func modelPath(t testing.TB) string {
 	t.Helper()
 	protoFile := os.Getenv("MODELPATH")
 	if protoFile == "" {
 		t.Fatal("Need MODELPATH env var to run tests")
 	}
+	return protoFile
+}
 
-	proc, err := NewProcessorFromPath(protoFile)
+func createProcessor(t testing.TB) *Processor {
+	t.Helper()
+	proc, err := NewProcessorFromPath(modelPath(t))
 	if err != nil {
 		t.Error(err)
 	}
@@ -241,3 +255,591 @@ func TestInfo(t *testing.T) {
 		t.Errorf("got %v, want %v", info.UnknownID, wantUNK)
 	}
 }
+
+func TestEncodeContext(t *testing.T) {
+	proc := createProcessor(t)
+	want := proc.Encode(sampleText)
+
+	for _, opts := range [][]Option{
+		nil,
+		{WithWordCache(100)},
+		{WithMaxInputSize(len(sampleText)), WithMaxTokens(len(want))},
+	} {
+		p := NewProcessorFromModel(proc.Model(), opts...)
+		got, err := p.EncodeContext(context.Background(), sampleText)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestEncodeContextLimits(t *testing.T) {
+	proc := createProcessor(t)
+	numTokens := len(proc.Encode(sampleText))
+
+	var tests = []struct {
+		opt       Option
+		wantLimit string
+	}{
+		{WithMaxInputSize(len(sampleText) - 1), "input size"},
+		{WithMaxTokens(numTokens - 1), "token count"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantLimit, func(t *testing.T) {
+			p := NewProcessorFromModel(proc.Model(), tt.opt)
+			_, err := p.EncodeContext(context.Background(), sampleText)
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("got error %v, want LimitError", err)
+			}
+			if limitErr.Limit != tt.wantLimit {
+				t.Errorf("got limit %q, want %q", limitErr.Limit, tt.wantLimit)
+			}
+
+			// Encode isn't limited.
+			if got := len(p.Encode(sampleText)); got != numTokens {
+				t.Errorf("got %d tokens from Encode, want %d", got, numTokens)
+			}
+		})
+	}
+}
+
+// countdownContext is a context that becomes canceled after its Err method
+// was called n times, to simulate cancellation in the middle of encoding.
+type countdownContext struct {
+	context.Context
+	n int
+}
+
+func (ctx *countdownContext) Err() error {
+	if ctx.n--; ctx.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestEncodeContextCanceled(t *testing.T) {
+	proc := createProcessor(t)
+	text := strings.Repeat(sampleText, 1000)
+
+	for _, opts := range [][]Option{nil, {WithWordCache(100)}} {
+		p := NewProcessorFromModel(proc.Model(), opts...)
+		for _, n := range []int{0, 1, 2} {
+			ctx := &countdownContext{Context: context.Background(), n: n}
+			if _, err := p.EncodeContext(ctx, text); !errors.Is(err, context.Canceled) {
+				t.Errorf("n=%d: got error %v, want %v", n, err, context.Canceled)
+			}
+		}
+	}
+}
+
+func TestPieceToIDRoundTrip(t *testing.T) {
+	proc := createProcessor(t)
+	vocabSize := proc.ModelInfo().VocabularySize
+
+	for id := range vocabSize {
+		piece, ok := proc.IDToPiece(id)
+		if !ok {
+			t.Fatalf("IDToPiece(%d) failed", id)
+		}
+		// Pieces may appear several times in the vocabulary, in which case
+		// PieceToID returns one of the IDs.
+		gotID, ok := proc.PieceToID(piece)
+		if !ok {
+			t.Errorf("PieceToID(%q) failed", piece)
+		} else if gotPiece, _ := proc.IDToPiece(gotID); gotPiece != piece {
+			t.Errorf("PieceToID(%q) = %d with piece %q", piece, gotID, gotPiece)
+		}
+	}
+
+	for _, id := range []int{-1, vocabSize} {
+		if _, ok := proc.IDToPiece(id); ok {
+			t.Errorf("IDToPiece(%d) succeeded, want failure", id)
+		}
+	}
+	if _, ok := proc.PieceToID("no such piece, surely"); ok {
+		t.Errorf("PieceToID succeeded for unknown piece")
+	}
+}
+
+func TestProtectedSymbols(t *testing.T) {
+	proc := createProcessor(t)
+	m := proc.Model()
+
+	// A protected symbol that isn't in the vocabulary is encoded as the
+	// unknown token, or as bytes with byte fallback.
+	text := "hello {{name}}, world"
+	symbol := replaceSpacesBySeparator("{{name}}")
+	var wantSymbolTokens []Token
+	if m.proto.GetTrainerSpec().GetByteFallback() {
+		for i := 0; i < len(symbol); i++ {
+			wantSymbolTokens = append(wantSymbolTokens, m.byte2Token[symbol[i]])
+		}
+	} else {
+		wantSymbolTokens = []Token{{ID: m.unknownID, Text: symbol}}
+	}
+
+	for _, opts := range [][]Option{
+		{WithProtectedSymbols("{{name}}")},
+		{WithProtectedSymbols("{{name}}"), WithWordCache(100)},
+	} {
+		p := NewProcessorFromModel(m, opts...)
+		before := p.Encode("hello ")
+		after := p.Encode(", world")
+		want := slices.Concat(before, wantSymbolTokens, after)
+		got := p.Encode(text)
+		if !slices.Equal(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if decoded := p.DecodeTokens(got); decoded != text {
+			t.Errorf("got decoded %q, want %q", decoded, text)
+		}
+	}
+
+	// A protected symbol that is in the vocabulary is encoded as its token,
+	// even where merges would produce other tokens.
+	tokens := proc.Encode("xhello worldx")
+	var multi Token
+	for _, tok := range proc.Encode("hello world") {
+		if utf8.RuneCountInString(tok.Text) > 1 {
+			multi = tok
+		}
+	}
+	if multi.Text == "" {
+		t.Skip("no multi-rune pieces")
+	}
+	p := NewProcessorFromModel(m, WithProtectedSymbols(replaceSeparatorsBySpace(multi.Text)))
+	got := p.Encode("xhello worldx")
+	if !slices.Contains(got, multi) {
+		t.Errorf("got %v, want it to contain %v (without protection: %v)", got, multi, tokens)
+	}
+
+	// The model isn't affected.
+	if got := NewProcessorFromModel(m).Encode(text); !slices.Equal(got, proc.Encode(text)) {
+		t.Errorf("protected symbols affected other processors")
+	}
+}
+
+func TestVocabularyRestriction(t *testing.T) {
+	proc := createProcessor(t)
+	m := proc.Model()
+
+	texts := []string{
+		"hello world",
+		"Bienvenido a este proyecto",
+		"if allow == true { return x;} else {return x+y;}",
+		"one line\nand another line",
+	}
+
+	for _, text := range texts {
+		t.Run(text, func(t *testing.T) {
+			want := proc.Encode(text)
+
+			// Allowing exactly the pieces the text is encoded with doesn't change
+			// its tokens.
+			var used []string
+			var usedIDs []int
+			for _, tok := range want {
+				used = append(used, tok.Text)
+				usedIDs = append(usedIDs, tok.ID)
+			}
+			for _, opt := range []Option{WithVocabulary(used), WithVocabularyIDs(usedIDs)} {
+				if got := NewProcessorFromModel(m, opt).Encode(text); !slices.Equal(got, want) {
+					t.Errorf("got %v, want %v", got, want)
+				}
+			}
+
+			// Disallowing the longest piece splits it, and only it.
+			longest := 0
+			for i, tok := range want {
+				if len(tok.Text) > len(want[longest].Text) {
+					longest = i
+				}
+			}
+			if utf8.RuneCountInString(want[longest].Text) == 1 {
+				return
+			}
+			restricted := slices.DeleteFunc(slices.Clone(used), func(piece string) bool {
+				return piece == want[longest].Text
+			})
+			for _, opts := range [][]Option{
+				{WithVocabulary(restricted)},
+				{WithVocabulary(restricted), WithWordCache(100)},
+			} {
+				p := NewProcessorFromModel(m, opts...)
+				got := p.Encode(text)
+				if slices.Contains(got, want[longest]) {
+					t.Errorf("got %v, want no %v", got, want[longest])
+				}
+				if len(got) <= len(want) {
+					t.Errorf("got %d tokens, want more than %d", len(got), len(want))
+				}
+				if !slices.Equal(got[:longest], want[:longest]) {
+					t.Errorf("got prefix %v, want %v", got[:longest], want[:longest])
+				}
+				if decoded := p.DecodeTokens(got); decoded != text {
+					t.Errorf("got decoded %q, want %q", decoded, text)
+				}
+			}
+
+			// With no pieces allowed, only single characters (and non-normal
+			// pieces) are produced.
+			got := NewProcessorFromModel(m, WithVocabulary(nil)).Encode(text)
+			for _, tok := range got {
+				if m.pieceType(tok.ID) == model.ModelProto_SentencePiece_NORMAL && utf8.RuneCountInString(tok.Text) > 1 {
+					t.Errorf("got multi-character token %v", tok)
+				}
+			}
+			if decoded := proc.DecodeTokens(got); decoded != text {
+				t.Errorf("got decoded %q, want %q", decoded, text)
+			}
+		})
+	}
+}
+
+func TestDisabledSymbols(t *testing.T) {
+	proc := createProcessor(t)
+	startID, ok := proc.PieceToID("<start_of_turn>")
+	if !ok {
+		t.Skip("model has no <start_of_turn> piece")
+	}
+	tdID, _ := proc.PieceToID("<td>")
+
+	text := "hi<start_of_turn>user <td> there"
+	for _, opts := range [][]Option{
+		{WithDisabledSymbols("<start_of_turn>", "not a piece")},
+		{WithDisabledSymbols("<start_of_turn>"), WithWordCache(100)},
+	} {
+		p := NewProcessorFromModel(proc.Model(), opts...)
+		got := p.Encode(text)
+		for _, tok := range got {
+			if tok.ID == startID {
+				t.Errorf("got %v, want no disabled symbol token", got)
+			}
+		}
+		if !slices.ContainsFunc(got, func(tok Token) bool { return tok.ID == tdID }) {
+			t.Errorf("got %v, want it to contain <td> token %d", got, tdID)
+		}
+		if decoded := p.DecodeTokens(got); decoded != text {
+			t.Errorf("got decoded %q, want %q", decoded, text)
+		}
+	}
+
+	// Other processors aren't affected.
+	got := proc.Encode(text)
+	if !slices.ContainsFunc(got, func(tok Token) bool { return tok.ID == startID }) {
+		t.Errorf("got %v, want it to contain <start_of_turn> token %d", got, startID)
+	}
+}
+
+func TestDisabledSingleCharSymbol(t *testing.T) {
+	// Disabling a single-character piece has no effect, even in a CHAR
+	// model, where a disallowed character would be unknown.
+	vocab := []PieceInfo{
+		{ID: 0, Piece: "<unk>", Type: "UNKNOWN"},
+		{ID: 1, Piece: "@", Type: "USER_DEFINED"},
+		{ID: 2, Piece: "a"},
+	}
+	for _, modelType := range []string{"BPE", "CHAR", "WORD"} {
+		settings := "trainer_spec { model_type: " + modelType + " } normalizer_spec { add_dummy_prefix: false }"
+		data, err := BuildModelProto(vocab, []byte(settings))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := LoadModelFromBytes(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := NewProcessorFromModel(m).Encode("a@a")
+		got := NewProcessorFromModel(m, WithDisabledSymbols("@")).Encode("a@a")
+		if !slices.Equal(got, want) || !slices.Contains(got, Token{ID: 1, Text: "@"}) {
+			t.Errorf("%s: got %v, want %v", modelType, got, want)
+		}
+	}
+}
+
+func TestDecodeWithSpans(t *testing.T) {
+	proc := createProcessor(t)
+	m := proc.Model()
+	info := proc.ModelInfo()
+
+	var ids []int
+	for _, tok := range proc.Encode("hello <td> world") {
+		ids = append(ids, tok.ID)
+	}
+	n := len(ids)
+	ids = append([]int{info.BeginningOfSentenceID}, ids...)
+	// A rune from byte tokens, an invalid byte, the unknown token and EOS.
+	for _, b := range []byte("🤨") {
+		ids = append(ids, m.byte2Token[b].ID)
+	}
+	ids = append(ids, m.byte2Token[0xE0].ID, info.UnknownID, info.EndOfSentenceID)
+
+	text, spans := proc.DecodeWithSpans(ids)
+	if want := proc.Decode(ids); text != want {
+		t.Errorf("got text %q, want %q", text, want)
+	}
+	if len(spans) != len(ids) {
+		t.Fatalf("got %d spans, want %d", len(spans), len(ids))
+	}
+
+	if spans[0] != (Span{0, 0}) {
+		t.Errorf("got BOS span %v, want empty span at 0", spans[0])
+	}
+	pos := 0
+	for i := 1; i <= n; i++ {
+		piece, _ := proc.IDToPiece(ids[i])
+		surface := replaceSeparatorsBySpace(piece)
+		want := Span{pos, pos + len(surface)}
+		if spans[i] != want || text[spans[i].Start:spans[i].End] != surface {
+			t.Errorf("got span %v for %q, want %v", spans[i], piece, want)
+		}
+		pos = spans[i].End
+	}
+
+	rest := spans[n+1:]
+	wantRest := []Span{
+		{pos, pos + 4}, {pos, pos + 4}, {pos, pos + 4}, {pos, pos + 4},
+		{pos + 4, pos + 7},
+		{pos + 7, pos + 7 + len(m.proto.GetTrainerSpec().GetUnkSurface())},
+	}
+	eos := wantRest[len(wantRest)-1].End
+	wantRest = append(wantRest, Span{eos, eos})
+	if !slices.Equal(rest, wantRest) {
+		t.Errorf("got spans %v, want %v", rest, wantRest)
+	}
+	if got := text[pos : pos+4]; got != "🤨" {
+		t.Errorf("got %q for byte tokens, want %q", got, "🤨")
+	}
+	if got := text[pos+4 : pos+7]; got != "�" {
+		t.Errorf("got %q for invalid byte, want %q", got, "�")
+	}
+	if eos != len(text) {
+		t.Errorf("got end %d, want %d", eos, len(text))
+	}
+}
+
+func TestDecodeWithOptions(t *testing.T) {
+	proc := createProcessor(t)
+	m := proc.Model()
+	info := proc.ModelInfo()
+	bos, _ := proc.IDToPiece(info.BeginningOfSentenceID)
+	eos, _ := proc.IDToPiece(info.EndOfSentenceID)
+	unkSurface := m.proto.GetTrainerSpec().GetUnkSurface()
+
+	var ids []int
+	ids = append(ids, info.BeginningOfSentenceID)
+	for _, tok := range proc.Encode("hi") {
+		ids = append(ids, tok.ID)
+	}
+	ids = append(ids, info.UnknownID, m.byte2Token['a'].ID, m.byte2Token[0xE0].ID, m.byte2Token['b'].ID, info.EndOfSentenceID)
+
+	customSurface, noSurface := "[UNK]", ""
+
+	var tests = []struct {
+		name    string
+		opts    DecodeOptions
+		want    string
+		wantErr *InvalidUTF8Error
+	}{
+		{"default", DecodeOptions{}, "hi" + unkSurface + "a�b", nil},
+		{"show control", DecodeOptions{ShowControl: true}, bos + "hi" + unkSurface + "a�b" + eos, nil},
+		{"unknown surface", DecodeOptions{UnknownSurface: &customSurface}, "hi[UNK]a�b", nil},
+		{"empty unknown surface", DecodeOptions{UnknownSurface: &noSurface}, "hia�b", nil},
+		{"skip invalid", DecodeOptions{InvalidUTF8: SkipInvalidUTF8}, "hi" + unkSurface + "ab", nil},
+		{"error on invalid", DecodeOptions{InvalidUTF8: ErrorOnInvalidUTF8}, "", &InvalidUTF8Error{Index: len(ids) - 3, ID: m.byte2Token[0xE0].ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := proc.DecodeWithOptions(ids, tt.opts)
+			if tt.wantErr != nil {
+				var utf8Err *InvalidUTF8Error
+				if !errors.As(err, &utf8Err) || *utf8Err != *tt.wantErr {
+					t.Errorf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Valid UTF-8 from byte tokens never fails.
+	var valid []int
+	for _, b := range []byte("🤨�") {
+		valid = append(valid, m.byte2Token[b].ID)
+	}
+	if got, err := proc.DecodeWithOptions(valid, DecodeOptions{InvalidUTF8: ErrorOnInvalidUTF8}); err != nil || got != "🤨�" {
+		t.Errorf("got %q, %v; want %q", got, err, "🤨�")
+	}
+
+	// IDs out of range fail rather than panic.
+	for _, id := range []int{-1, info.VocabularySize} {
+		_, err := proc.DecodeWithOptions([]int{ids[1], id}, DecodeOptions{})
+		var idErr *InvalidIDError
+		if !errors.As(err, &idErr) || *idErr != (InvalidIDError{Index: 1, ID: id}) {
+			t.Errorf("ID %d: got error %v, want InvalidIDError", id, err)
+		}
+	}
+}
+
+func TestDecodeDenormalizer(t *testing.T) {
+	rules := map[string]string{" ,": ",", "hello": "Hello", "🤨": ":|"}
+	precompiled, err := charsmap.Compile(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tsv := "20 2C\t2C\n68 65 6C 6C 6F\t48 65 6C 6C 6F # hello -> Hello\n1F928\t3A 7C\n"
+
+	var tests = []struct {
+		name string
+		spec *model.NormalizerSpec
+	}{
+		{"precompiled", &model.NormalizerSpec{PrecompiledCharsmap: precompiled}},
+		{"rule tsv", &model.NormalizerSpec{NormalizationRuleTsv: proto.String(tsv)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mp := loadModelProto(t)
+			mp.DenormalizerSpec = tt.spec
+			m, err := newModel(mp)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The model must work the same after a precompiled round trip.
+			var buf bytes.Buffer
+			if err := m.WriteCompiled(&buf); err != nil {
+				t.Fatal(err)
+			}
+			compiled, err := LoadModelFromBytes(buf.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, m := range []*Model{m, compiled} {
+				proc := NewProcessorFromModel(m)
+				var ids []int
+				for _, tok := range proc.Encode("hello , world 🤨") {
+					ids = append(ids, tok.ID)
+				}
+				want := "Hello, world :|"
+				if got := proc.Decode(ids); got != want {
+					t.Errorf("got %q, want %q", got, want)
+				}
+
+				text, spans := proc.DecodeWithSpans(ids)
+				if text != want {
+					t.Errorf("got text %q, want %q", text, want)
+				}
+				// Spans follow each other, except that the byte tokens of a
+				// rune share its span.
+				end := 0
+				for i, span := range spans {
+					shared := i > 0 && span == spans[i-1] && span.Start < span.End
+					if (span.Start != end && !shared) || span.End < span.Start {
+						t.Errorf("got span %v for token %d, want a span starting at %d", span, i, end)
+					}
+					end = span.End
+				}
+				if end != len(text) {
+					t.Errorf("got spans ending at %d, want %d", end, len(text))
+				}
+			}
+		})
+	}
+
+	t.Run("bad rule tsv", func(t *testing.T) {
+		mp := loadModelProto(t)
+		mp.DenormalizerSpec = &model.NormalizerSpec{NormalizationRuleTsv: proto.String("41 42\n")}
+		if _, err := newModel(mp); err == nil {
+			t.Error("got no error for a bad rule TSV")
+		}
+	})
+}
+
+func TestWhitespaceOptions(t *testing.T) {
+	proc := createProcessor(t)
+
+	var tests = []struct {
+		name                                        string
+		addDummyPrefix, removeExtra, escape, suffix bool
+		text, normalized, decoded                   string
+	}{
+		{"dummy prefix", true, true, true, false,
+			"  hello   world, hello ", "▁hello▁world,▁hello", "hello world, hello"},
+		{"dummy suffix", true, true, true, true,
+			"  hello   world, hello ", "hello▁world,▁hello▁", "hello world, hello"},
+		{"suffix without dummy", false, false, true, true,
+			"hello  world ", "hello▁▁world▁", "hello  world "},
+		{"unescaped", false, false, false, false,
+			"hello  world▁", "hello  world▁", "hello  world▁"},
+		{"unescaped dummy prefix", true, true, false, false,
+			" hello  world▁", " hello world▁", "hello world▁"},
+		{"unescaped dummy suffix", true, true, false, true,
+			" hello  world▁", "hello world▁ ", "hello world▁"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mp := loadModelProto(t)
+			mp.NormalizerSpec.AddDummyPrefix = proto.Bool(tt.addDummyPrefix)
+			mp.NormalizerSpec.RemoveExtraWhitespaces = proto.Bool(tt.removeExtra)
+			mp.NormalizerSpec.EscapeWhitespaces = proto.Bool(tt.escape)
+			mp.TrainerSpec.TreatWhitespaceAsSuffix = proto.Bool(tt.suffix)
+			if !tt.escape {
+				// A model trained without escaping has spaces in its pieces.
+				for _, piece := range mp.Pieces {
+					if piece.GetType() == model.ModelProto_SentencePiece_NORMAL {
+						piece.Piece = proto.String(replaceSeparatorsBySpace(piece.GetPiece()))
+					}
+				}
+			}
+			m, err := newModel(mp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Normalizer().Normalize(tt.text); got != tt.normalized {
+				t.Errorf("got normalized %q, want %q", got, tt.normalized)
+			}
+
+			p := NewProcessorFromModel(m)
+			tokens := p.Encode(tt.text)
+			if tt.escape {
+				// The model's pieces are the same, so the tokens are those of the
+				// normalized text with the original options.
+				if want := proc.Encode(replaceSeparatorsBySpace(tt.normalized)); !slices.Equal(tokens, want) {
+					t.Errorf("got tokens %v, want %v", tokens, want)
+				}
+			}
+			if got := NewProcessorFromModel(m, WithWordCache(100)).Encode(tt.text); !slices.Equal(got, tokens) {
+				t.Errorf("got tokens %v with word cache, want %v", got, tokens)
+			}
+
+			info := p.ModelInfo()
+			ids := []int{info.BeginningOfSentenceID}
+			for _, tok := range tokens {
+				ids = append(ids, tok.ID)
+			}
+			ids = append(ids, info.EndOfSentenceID)
+			if got := p.Decode(ids); got != tt.decoded {
+				t.Errorf("got decoded %q, want %q", got, tt.decoded)
+			}
+			if got, _ := p.DecodeWithSpans(ids); got != tt.decoded {
+				t.Errorf("got decoded %q with spans, want %q", got, tt.decoded)
+			}
+			for _, chunkSize := range []int{1, 3} {
+				if got := streamDecode(t, p, ids, chunkSize); got != tt.decoded {
+					t.Errorf("got stream decoded %q with chunk size %d, want %q", got, chunkSize, tt.decoded)
+				}
+			}
+		})
+	}
+}
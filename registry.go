@@ -0,0 +1,212 @@
+package sentencepiece
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Registry provides Processors for a set of models stored as files in a
+// directory (or any fs.FS), identified by name: the model named "gemma" is
+// read from the file "gemma.spmc" (a precompiled model; see
+// [Model.WriteCompiled]) or, if there's no such file, from "gemma.model".
+//
+// Models are loaded lazily, when first requested, and only once. Models are
+// also identified by the hash of their file contents: if several names have
+// the same contents, they share a single loaded Model.
+//
+// A Registry is safe for concurrent use.
+type Registry struct {
+	fsys fs.FS
+	opts []Option
+
+	mu      sync.Mutex
+	entries map[string]*registryEntry
+	byHash  map[string]*Model
+}
+
+type registryEntry struct {
+	mu   sync.Mutex
+	proc *Processor
+	hash string
+}
+
+// Extensions of model files in a Registry, in order of preference.
+var registryExtensions = []string{".spmc", ".model"}
+
+// NewRegistry creates a Registry for the models in fsys. The Processors it
+// creates are configured with opts.
+func NewRegistry(fsys fs.FS, opts ...Option) *Registry {
+	return &Registry{
+		fsys:    fsys,
+		opts:    opts,
+		entries: make(map[string]*registryEntry),
+		byHash:  make(map[string]*Model),
+	}
+}
+
+// NewRegistryFromDir creates a Registry for the models in directory dir. See
+// [NewRegistry].
+func NewRegistryFromDir(dir string, opts ...Option) *Registry {
+	return NewRegistry(os.DirFS(dir), opts...)
+}
+
+// Names returns the sorted names of the models available in the registry,
+// whether they're loaded or not.
+func (r *Registry) Names() ([]string, error) {
+	dirEntries, err := fs.ReadDir(r.fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, de := range dirEntries {
+		ext := path.Ext(de.Name())
+		if de.IsDir() || !slices.Contains(registryExtensions, ext) {
+			continue
+		}
+		name := strings.TrimSuffix(de.Name(), ext)
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// Processor returns the Processor for the named model, loading the model if
+// it isn't loaded yet. All calls with the same name return the same
+// Processor.
+func (r *Registry) Processor(name string) (*Processor, error) {
+	e, err := r.load(name)
+	if err != nil {
+		return nil, err
+	}
+	return e.proc, nil
+}
+
+// Hash returns the content hash of the named model (the hex-encoded SHA-256
+// of its file), loading the model if it isn't loaded yet.
+func (r *Registry) Hash(name string) (string, error) {
+	e, err := r.load(name)
+	if err != nil {
+		return "", err
+	}
+	return e.hash, nil
+}
+
+// LoadedModel describes a model loaded by a [Registry].
+type LoadedModel struct {
+	Name string
+	Hash string
+	Info *ModelInfo
+}
+
+// Loaded returns descriptions of all the models loaded so far, sorted by
+// name.
+func (r *Registry) Loaded() []LoadedModel {
+	r.mu.Lock()
+	entries := make(map[string]*registryEntry, len(r.entries))
+	for name, e := range r.entries {
+		entries[name] = e
+	}
+	r.mu.Unlock()
+
+	var loaded []LoadedModel
+	for name, e := range entries {
+		e.mu.Lock()
+		if e.proc != nil {
+			loaded = append(loaded, LoadedModel{Name: name, Hash: e.hash, Info: e.proc.ModelInfo()})
+		}
+		e.mu.Unlock()
+	}
+	slices.SortFunc(loaded, func(a, b LoadedModel) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return loaded
+}
+
+// load returns the registry entry for the named model, loading the model if
+// needed. Loading errors aren't cached, so a failed load is retried by the
+// next call.
+func (r *Registry) load(name string) (*registryEntry, error) {
+	if name == "" || strings.Contains(name, "/") || !fs.ValidPath(name) {
+		return nil, fmt.Errorf("invalid model name %q", name)
+	}
+
+	r.mu.Lock()
+	e, ok := r.entries[name]
+	if !ok {
+		e = &registryEntry{}
+		r.entries[name] = e
+	}
+	r.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.proc != nil {
+		return e, nil
+	}
+
+	data, err := r.readModelFile(name)
+	if err != nil {
+		r.forget(name, e)
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	r.mu.Lock()
+	m := r.byHash[hash]
+	r.mu.Unlock()
+	if m == nil {
+		if m, err = LoadModelFromBytes(data); err != nil {
+			r.forget(name, e)
+			return nil, fmt.Errorf("unable to load model %q: %v", name, err)
+		}
+		r.mu.Lock()
+		// Another name with the same contents may have been loaded meanwhile;
+		// if so, share its model.
+		if other := r.byHash[hash]; other != nil {
+			m = other
+		} else {
+			r.byHash[hash] = m
+		}
+		r.mu.Unlock()
+	}
+
+	e.proc = NewProcessorFromModel(m, r.opts...)
+	e.hash = hash
+	return e, nil
+}
+
+// forget removes the entry of a model that failed to load, so that lookups of
+// missing names don't accumulate entries. The entry is only removed if it's
+// still the one registered for the name.
+func (r *Registry) forget(name string, e *registryEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.entries[name] == e {
+		delete(r.entries, name)
+	}
+}
+
+// readModelFile reads the file of the named model.
+func (r *Registry) readModelFile(name string) ([]byte, error) {
+	for _, ext := range registryExtensions {
+		data, err := fs.ReadFile(r.fsys, name+ext)
+		if err == nil {
+			return data, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("unable to read model %q: %v", name, err)
+		}
+	}
+	return nil, fmt.Errorf("model %q not found", name)
+}
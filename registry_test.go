@@ -0,0 +1,134 @@
+package sentencepiece
+
+import (
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRegistry(t *testing.T) {
+	protoData, err := os.ReadFile(modelPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, compiledData := compileModel(t)
+
+	fsys := fstest.MapFS{
+		"gemma.model":   {Data: protoData},
+		"gemma2.model":  {Data: protoData},
+		"fast.spmc":     {Data: compiledData},
+		"fast.model":    {Data: []byte("not a model; fast.spmc is preferred")},
+		"broken.model":  {Data: []byte("not a model")},
+		"README.txt":    {Data: []byte("hello")},
+		"subdir/x.spmc": {Data: compiledData},
+	}
+	r := NewRegistry(fsys, WithWordCache(100))
+
+	names, err := r.Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"broken", "fast", "gemma", "gemma2"}; !slices.Equal(names, want) {
+		t.Errorf("got names %v, want %v", names, want)
+	}
+	if loaded := r.Loaded(); len(loaded) != 0 {
+		t.Errorf("got %d loaded models before loading, want 0", len(loaded))
+	}
+
+	want := createProcessor(t).Encode(sampleText)
+	procs := make(map[string]*Processor)
+	for _, name := range []string{"gemma", "gemma2", "fast"} {
+		proc, err := r.Processor(name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := proc.Encode(sampleText); !slices.Equal(got, want) {
+			t.Errorf("%s: Encode results differ", name)
+		}
+		if proc.wordCache == nil {
+			t.Errorf("%s: options weren't applied", name)
+		}
+		procs[name] = proc
+	}
+
+	// Processors are created once, and models with the same contents are
+	// shared.
+	if again, _ := r.Processor("gemma"); again != procs["gemma"] {
+		t.Errorf("got a different processor for the second request")
+	}
+	if procs["gemma"] == procs["gemma2"] || procs["gemma"].Model() != procs["gemma2"].Model() {
+		t.Errorf("expected different processors sharing a model")
+	}
+	if procs["gemma"].Model() == procs["fast"].Model() {
+		t.Errorf("expected different models for different contents")
+	}
+
+	loaded := r.Loaded()
+	if len(loaded) != 3 {
+		t.Fatalf("got %d loaded models, want 3", len(loaded))
+	}
+	for _, lm := range loaded {
+		hash, err := r.Hash(lm.Name)
+		if err != nil || hash != lm.Hash || len(hash) != 64 {
+			t.Errorf("%s: got hash %q (%v), want %q", lm.Name, hash, err, lm.Hash)
+		}
+		if *lm.Info != *procs[lm.Name].ModelInfo() {
+			t.Errorf("%s: got info %v", lm.Name, lm.Info)
+		}
+	}
+	if loaded[1].Hash != loaded[2].Hash || loaded[0].Hash == loaded[1].Hash {
+		t.Errorf("unexpected hashes in %v", loaded)
+	}
+
+	for _, name := range []string{"broken", "missing", "README", "", "subdir/x", "../gemma"} {
+		if _, err := r.Processor(name); err == nil {
+			t.Errorf("%q: expected error", name)
+		}
+	}
+	if got := len(r.Loaded()); got != 3 {
+		t.Errorf("got %d loaded models after errors, want 3", got)
+	}
+	// Failed loads don't leave entries behind.
+	if got := len(r.entries); got != 3 {
+		t.Errorf("got %d entries after errors, want 3", got)
+	}
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	protoData, err := os.ReadFile(modelPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry(fstest.MapFS{
+		"a.model": {Data: protoData},
+		"b.model": {Data: protoData},
+	})
+
+	var wg sync.WaitGroup
+	procs := make([]*Processor, 8)
+	for i := range procs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := []string{"a", "b"}[i%2]
+			proc, err := r.Processor(name)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			procs[i] = proc
+		}()
+	}
+	wg.Wait()
+
+	for i := range procs {
+		if procs[i] != procs[i%2] {
+			t.Errorf("got different processors for the same name")
+		}
+		if procs[i].Model() != procs[0].Model() {
+			t.Errorf("got different models for the same contents")
+		}
+	}
+}
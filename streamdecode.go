@@ -0,0 +1,121 @@
+package sentencepiece
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// StreamDecoder decodes token IDs incrementally, as they're generated by a
+// model. Byte tokens that form a partial UTF-8 sequence are held back until
+// the sequence is complete, so the concatenation of all the text returned by
+// a StreamDecoder is the same as what [Processor.Decode] returns for all the
+// IDs at once. For models that treat whitespace as a suffix, a space at the
+// end of a token is held back until more text follows.
+//
+// For models with denormalizer rules, the rules are applied to the text of
+// each token (or of each rune, for byte tokens) separately, so a rule whose
+// source spans several tokens isn't applied, unlike in [Processor.Decode].
+//
+// A StreamDecoder is not safe for concurrent use.
+type StreamDecoder struct {
+	proc *Processor
+
+	// pending holds the bytes of byte tokens that don't form a complete rune
+	// yet.
+	pending []byte
+
+	// started is set once a token that isn't a control token is decoded; the
+	// dummy whitespace at the start of the text is removed before that.
+	started bool
+
+	// heldSpace is set when the text decoded so far ends with a space that's
+	// held back, for models that treat whitespace as a suffix: if no more
+	// text follows, it's the dummy whitespace, which is removed.
+	heldSpace bool
+}
+
+// NewStreamDecoder creates a new StreamDecoder for the processor.
+func (proc *Processor) NewStreamDecoder() *StreamDecoder {
+	return &StreamDecoder{proc: proc}
+}
+
+// Decode decodes the next IDs in the stream, and returns the text that can be
+// emitted so far. If some ID is out of the vocabulary's range, it returns an
+// [*InvalidIDError], and none of the IDs are decoded.
+func (d *StreamDecoder) Decode(ids []int) (string, error) {
+	if err := d.proc.checkIDs(ids); err != nil {
+		return "", err
+	}
+	n := d.proc.model.normalizer
+	var sb strings.Builder
+	for _, id := range ids {
+		if d.proc.isControlID(id) {
+			// Control tokens decode to nothing, but end runs of byte tokens.
+			d.writeRunes(&sb, true)
+			continue
+		}
+		trimDummy := !d.started && n.hasDummyWhitespace() && !n.treatWhitespaceAsSuffix
+		d.started = true
+
+		if d.proc.isByteID(id) {
+			d.writeHeldSpace(&sb)
+			d.pending = append(d.pending, d.proc.model.idToByte[id])
+			d.writeRunes(&sb, false)
+			continue
+		}
+		d.writeRunes(&sb, true)
+		d.writeHeldSpace(&sb)
+		if id == d.proc.model.unknownID {
+			sb.WriteString(d.proc.Decode([]int{id}))
+			continue
+		}
+
+		// With whitespace as a suffix, the trailing whitespace of a piece is
+		// held back, since it's the dummy whitespace if no text follows.
+		holdSpace := n.hasDummyWhitespace() && n.treatWhitespaceAsSuffix &&
+			strings.HasSuffix(d.proc.model.pieceString(id), n.whitespace())
+		surface := d.proc.pieceSurface(id, trimDummy || holdSpace)
+		d.heldSpace = holdSpace
+		if dn := d.proc.model.denormalizer; dn != nil {
+			surface = dn.Normalize(surface)
+		}
+		sb.WriteString(surface)
+	}
+	return sb.String(), nil
+}
+
+// writeHeldSpace writes the space held back by d, if any, to sb.
+func (d *StreamDecoder) writeHeldSpace(sb *strings.Builder) {
+	if d.heldSpace {
+		sb.WriteByte(' ')
+		d.heldSpace = false
+	}
+}
+
+// Flush returns the text of any byte tokens held back, decoding incomplete
+// UTF-8 sequences as U+FFFD. It should be called at the end of the stream.
+// For models that treat whitespace as a suffix, the final space of the text
+// is the dummy whitespace added by the normalizer, and it's dropped.
+func (d *StreamDecoder) Flush() string {
+	var sb strings.Builder
+	d.writeRunes(&sb, true)
+	d.heldSpace = false
+	return sb.String()
+}
+
+// writeRunes writes the runes in d.pending to sb; if all is false, a trailing
+// partial rune is kept pending.
+func (d *StreamDecoder) writeRunes(sb *strings.Builder, all bool) {
+	buf := d.pending
+	for len(buf) > 0 && (all || utf8.FullRune(buf)) {
+		// As in Decode, bad encodings are emitted as utf8.RuneError.
+		r, size := utf8.DecodeRune(buf)
+		if dn := d.proc.model.denormalizer; dn != nil {
+			sb.WriteString(dn.Normalize(string(r)))
+		} else {
+			sb.WriteRune(r)
+		}
+		buf = buf[size:]
+	}
+	d.pending = append(d.pending[:0], buf...)
+}
@@ -0,0 +1,118 @@
+package sentencepiece
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// streamDecode decodes ids with a StreamDecoder, feeding it chunkSize IDs at
+// a time.
+func streamDecode(t *testing.T, proc *Processor, ids []int, chunkSize int) string {
+	t.Helper()
+	d := proc.NewStreamDecoder()
+	var text string
+	for len(ids) > 0 {
+		n := min(chunkSize, len(ids))
+		chunk, err := d.Decode(ids[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		text += chunk
+		ids = ids[n:]
+	}
+	return text + d.Flush()
+}
+
+func TestStreamDecoder(t *testing.T) {
+	proc := createProcessor(t)
+
+	paths, err := filepath.Glob(filepath.Join("test", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts := []string{"", sampleText}
+	for _, path := range paths {
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		texts = append(texts, string(buf))
+	}
+
+	for i, text := range texts {
+		var ids []int
+		for _, tok := range proc.Encode(text) {
+			ids = append(ids, tok.ID)
+		}
+		want := proc.Decode(ids)
+		for _, chunkSize := range []int{1, 3, 100} {
+			if got := streamDecode(t, proc, ids, chunkSize); got != want {
+				t.Errorf("text #%d, chunk size %d: got different text from Decode", i, chunkSize)
+			}
+		}
+	}
+}
+
+func TestStreamDecoderInvalidID(t *testing.T) {
+	proc := createProcessor(t)
+	m := proc.Model()
+	d := proc.NewStreamDecoder()
+
+	// A failed call doesn't decode any of its IDs, so the held byte is still
+	// pending after it.
+	e9 := []byte("é")
+	if got, err := d.Decode([]int{m.byte2Token[e9[0]].ID}); err != nil || got != "" {
+		t.Fatalf("got %q, %v; want no text", got, err)
+	}
+	_, err := d.Decode([]int{m.byte2Token[e9[1]].ID, m.numPieces()})
+	var idErr *InvalidIDError
+	if !errors.As(err, &idErr) || *idErr != (InvalidIDError{Index: 1, ID: m.numPieces()}) {
+		t.Errorf("got error %v, want InvalidIDError", err)
+	}
+	if got, err := d.Decode([]int{m.byte2Token[e9[1]].ID}); err != nil || got != "é" {
+		t.Errorf("got %q, %v; want %q", got, err, "é")
+	}
+}
+
+func TestStreamDecoderBytes(t *testing.T) {
+	proc := createProcessor(t)
+
+	var byteIDs []int
+	for _, tok := range proc.model.byte2Token {
+		if tok.Text != "" {
+			byteIDs = append(byteIDs, tok.ID)
+		}
+	}
+	if len(byteIDs) == 0 {
+		t.Skip("model has no byte tokens")
+	}
+
+	// Random sequences of byte tokens, mixed with some other tokens, exercise
+	// partial and invalid UTF-8 sequences.
+	otherIDs := []int{proc.ModelInfo().UnknownID}
+	if id, ok := proc.PieceToID("a"); ok {
+		otherIDs = append(otherIDs, id)
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for range 200 {
+		ids := make([]int, rnd.Intn(20))
+		for i := range ids {
+			if rnd.Intn(10) == 0 {
+				ids[i] = otherIDs[rnd.Intn(len(otherIDs))]
+			} else {
+				ids[i] = byteIDs[rnd.Intn(len(byteIDs))]
+			}
+		}
+
+		want := proc.Decode(ids)
+		for _, chunkSize := range []int{1, 2, 5} {
+			if got := streamDecode(t, proc, ids, chunkSize); got != want {
+				t.Errorf("ids %v, chunk size %d: got %q, want %q", ids, chunkSize, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package sentencepiece
+
+import (
+	"cmp"
+	"math/bits"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/eliben/go-sentencepiece/internal/doublearray"
+	"github.com/eliben/go-sentencepiece/internal/model"
+)
+
+// TokenTrie indexes the tokens of a model by their surface: the text each
+// token decodes to, with spaces instead of whitespace separators ("▁"). It
+// answers prefix queries over the vocabulary, as needed for constrained
+// decoding (e.g. restricting generation to valid JSON): given the text the
+// output must continue with, find the tokens that can come next.
+//
+// The surface of a byte token is its single byte, which is usually not valid
+// UTF-8 on its own. Control tokens (which decode to nothing) and the unknown
+// token aren't in the trie. Several tokens may have the same surface, e.g.
+// the piece "a" and the byte token "<0x61>".
+//
+// A TokenTrie is immutable and safe for concurrent use.
+type TokenTrie struct {
+	// surfaces are the distinct surfaces of the tokens, sorted; the IDs of
+	// the tokens with surfaces[i] are ids[groupStart[i]:groupStart[i+1]].
+	surfaces   []string
+	groupStart []int32
+	ids        []int32
+
+	// groupOf maps each token ID to the index of its surface in surfaces, or
+	// -1 for tokens that aren't in the trie.
+	groupOf []int32
+
+	// trie maps each surface to its index in surfaces.
+	trie *doublearray.Trie
+}
+
+// TokenTrie returns the token trie of the model. Models that never need the
+// trie don't pay for building it; the first call builds it, and later calls
+// return the same trie.
+func (m *Model) TokenTrie() *TokenTrie {
+	m.tokenTrieOnce.Do(func() {
+		m.tokenTrie = newTokenTrie(m)
+	})
+	return m.tokenTrie
+}
+
+func newTokenTrie(m *Model) *TokenTrie {
+	type entry struct {
+		surface string
+		id      int
+	}
+	entries := make([]entry, 0, m.numPieces())
+	for id := range m.numPieces() {
+		switch m.pieceType(id) {
+		case model.ModelProto_SentencePiece_CONTROL, model.ModelProto_SentencePiece_UNKNOWN:
+			continue
+		case model.ModelProto_SentencePiece_BYTE:
+			if b, ok := m.idToByte[id]; ok {
+				entries = append(entries, entry{string([]byte{b}), id})
+			}
+		default:
+			entries = append(entries, entry{m.normalizer.unescape(m.pieceString(id)), id})
+		}
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		return cmp.Or(strings.Compare(a.surface, b.surface), cmp.Compare(a.id, b.id))
+	})
+
+	t := &TokenTrie{
+		ids:     make([]int32, len(entries)),
+		groupOf: make([]int32, m.numPieces()),
+	}
+	for id := range t.groupOf {
+		t.groupOf[id] = -1
+	}
+	for i, e := range entries {
+		if i == 0 || e.surface != entries[i-1].surface {
+			t.surfaces = append(t.surfaces, e.surface)
+			t.groupStart = append(t.groupStart, int32(i))
+		}
+		t.ids[i] = int32(e.id)
+		t.groupOf[e.id] = int32(len(t.surfaces) - 1)
+	}
+	t.groupStart = append(t.groupStart, int32(len(entries)))
+
+	groups := make([]int, len(t.surfaces))
+	for i := range groups {
+		groups[i] = i
+	}
+	t.trie = doublearray.New(t.surfaces, groups)
+	return t
+}
+
+// WithPrefix returns the set of tokens whose surface begins with prefix
+// (including those whose surface is prefix); an empty prefix returns all the
+// tokens in the trie.
+func (t *TokenTrie) WithPrefix(prefix string) IDSet {
+	set := newIDSet(len(t.groupOf))
+	lo, hi := t.prefixRange(prefix)
+	t.addGroups(&set, lo, hi)
+	return set
+}
+
+// PrefixesOf returns the set of tokens whose surface is a prefix of s
+// (including those whose surface is s).
+func (t *TokenTrie) PrefixesOf(s string) IDSet {
+	set := newIDSet(len(t.groupOf))
+	t.addPrefixesOf(&set, s)
+	return set
+}
+
+// Continuations returns the set of tokens that are valid continuations of
+// output that must continue with s: the tokens whose surface is a prefix of
+// s, and those whose surface begins with s. The former consume part of s,
+// and the latter all of it (and go beyond it).
+func (t *TokenTrie) Continuations(s string) IDSet {
+	set := newIDSet(len(t.groupOf))
+	t.addPrefixesOf(&set, s)
+	lo, hi := t.prefixRange(s)
+	t.addGroups(&set, lo, hi)
+	return set
+}
+
+// Surface returns the surface of the token with the given ID, and true; or
+// false if the token isn't in the trie.
+func (t *TokenTrie) Surface(id int) (string, bool) {
+	if id < 0 || id >= len(t.groupOf) || t.groupOf[id] < 0 {
+		return "", false
+	}
+	return t.surfaces[t.groupOf[id]], true
+}
+
+// prefixRange returns the range [lo, hi) of the indices of surfaces that
+// begin with prefix. Since surfaces are sorted, they're contiguous.
+func (t *TokenTrie) prefixRange(prefix string) (int, int) {
+	lo := sort.SearchStrings(t.surfaces, prefix)
+	n := sort.Search(len(t.surfaces)-lo, func(i int) bool {
+		return !strings.HasPrefix(t.surfaces[lo+i], prefix)
+	})
+	return lo, lo + n
+}
+
+// addGroups adds the tokens of surfaces [lo, hi) to set.
+func (t *TokenTrie) addGroups(set *IDSet, lo, hi int) {
+	for _, id := range t.ids[t.groupStart[lo]:t.groupStart[hi]] {
+		set.add(int(id))
+	}
+}
+
+// addPrefixesOf adds the tokens whose surface is a prefix of s to set, by
+// walking the trie along s.
+func (t *TokenTrie) addPrefixesOf(set *IDSet, s string) {
+	n := doublearray.Root
+	for i := 0; i < len(s); i++ {
+		var ok bool
+		if n, ok = t.trie.Child(n, s[i]); !ok {
+			return
+		}
+		if g, ok := t.trie.Value(n); ok {
+			t.addGroups(set, g, g+1)
+		}
+	}
+}
+
+// IDSet is a set of token IDs, as returned by [TokenTrie] queries. It's
+// represented as a bitset over the model's vocabulary, which is convenient
+// for masking logits. The zero value is an empty set.
+type IDSet struct {
+	words []uint64
+}
+
+func newIDSet(size int) IDSet {
+	return IDSet{words: make([]uint64, (size+63)/64)}
+}
+
+func (s *IDSet) add(id int) {
+	s.words[id/64] |= 1 << (id % 64)
+}
+
+// Contains reports whether id is in the set.
+func (s IDSet) Contains(id int) bool {
+	return id >= 0 && id/64 < len(s.words) && s.words[id/64]&(1<<(id%64)) != 0
+}
+
+// Len returns the number of IDs in the set.
+func (s IDSet) Len() int {
+	n := 0
+	for _, w := range s.words {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// IDs returns the IDs in the set, in ascending order.
+func (s IDSet) IDs() []int {
+	ids := make([]int, 0, s.Len())
+	for i, w := range s.words {
+		for w != 0 {
+			ids = append(ids, i*64+bits.TrailingZeros64(w))
+			w &= w - 1
+		}
+	}
+	return ids
+}
+
+// Union returns the set of IDs in s or in other.
+func (s IDSet) Union(other IDSet) IDSet {
+	a, b := s.words, other.words
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	u := IDSet{words: slices.Clone(a)}
+	for i, w := range b {
+		u.words[i] |= w
+	}
+	return u
+}
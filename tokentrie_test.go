@@ -0,0 +1,99 @@
+package sentencepiece
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTokenTrie(t *testing.T) {
+	proc := createProcessor(t)
+	m := proc.Model()
+	tt := m.TokenTrie()
+	if m.TokenTrie() != tt {
+		t.Errorf("got a different trie on second call")
+	}
+
+	// Compute the surfaces of all tokens independently of the trie.
+	surfaces := make(map[int]string)
+	for _, p := range m.Vocabulary() {
+		switch p.Type {
+		case "CONTROL", "UNKNOWN":
+		case "BYTE":
+			surfaces[p.ID] = string([]byte{byte(convertHexValue(p.Piece))})
+		default:
+			surfaces[p.ID] = strings.ReplaceAll(p.Piece, "▁", " ")
+		}
+	}
+
+	for id := range m.numPieces() {
+		want, wantOK := surfaces[id]
+		if got, ok := tt.Surface(id); got != want || ok != wantOK {
+			t.Errorf("Surface(%d) = %q, %v; want %q, %v", id, got, ok, want, wantOK)
+		}
+	}
+
+	wantIDs := func(pred func(surface string) bool) []int {
+		var ids []int
+		for id := range m.numPieces() {
+			if surface, ok := surfaces[id]; ok && pred(surface) {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+
+	for _, s := range []string{"", "h", "hel", "hello world", " the", "\xe0", "\xe0\xb8\xaa", `{"key": 1}`, "\x00", "zzzzzz"} {
+		t.Run(s, func(t *testing.T) {
+			withPrefix := wantIDs(func(surface string) bool { return strings.HasPrefix(surface, s) })
+			if got := tt.WithPrefix(s).IDs(); !slices.Equal(got, withPrefix) {
+				t.Errorf("WithPrefix: got %v, want %v", got, withPrefix)
+			}
+			prefixesOf := wantIDs(func(surface string) bool { return strings.HasPrefix(s, surface) })
+			if got := tt.PrefixesOf(s).IDs(); !slices.Equal(got, prefixesOf) {
+				t.Errorf("PrefixesOf: got %v, want %v", got, prefixesOf)
+			}
+			continuations := wantIDs(func(surface string) bool {
+				return strings.HasPrefix(surface, s) || strings.HasPrefix(s, surface)
+			})
+			got := tt.Continuations(s)
+			if !slices.Equal(got.IDs(), continuations) {
+				t.Errorf("Continuations: got %v, want %v", got.IDs(), continuations)
+			}
+			if got.Len() != len(continuations) {
+				t.Errorf("Continuations: got Len %d, want %d", got.Len(), len(continuations))
+			}
+		})
+	}
+
+	// Byte tokens are found along with the pieces with the same surface.
+	aByte := m.byte2Token['a'].ID
+	aPiece, _ := proc.PieceToID("a")
+	if set := tt.PrefixesOf("a"); !set.Contains(aByte) || !set.Contains(aPiece) {
+		t.Errorf("got %v, want it to contain %d and %d", set.IDs(), aByte, aPiece)
+	}
+}
+
+func TestIDSet(t *testing.T) {
+	var empty IDSet
+	if empty.Len() != 0 || empty.Contains(0) || len(empty.IDs()) != 0 {
+		t.Errorf("zero IDSet isn't empty")
+	}
+
+	a := newIDSet(200)
+	for _, id := range []int{0, 63, 64, 150} {
+		a.add(id)
+	}
+	b := newIDSet(100)
+	b.add(1)
+	b.add(64)
+
+	for _, u := range []IDSet{a.Union(b), b.Union(a)} {
+		if got, want := u.IDs(), []int{0, 1, 63, 64, 150}; !slices.Equal(got, want) {
+			t.Errorf("got union %v, want %v", got, want)
+		}
+	}
+	if a.Contains(1) || !a.Contains(150) || a.Contains(-1) || a.Contains(1000) {
+		t.Errorf("a.Contains is wrong for %v", a.IDs())
+	}
+}
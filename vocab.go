@@ -0,0 +1,222 @@
+package sentencepiece
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/eliben/go-sentencepiece/internal/model"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+// VocabFormat is a file format for vocabularies; see [Model.WriteVocab].
+type VocabFormat int
+
+const (
+	// VocabTSV has a line for each piece, in ID order, with tab-separated
+	// columns for the piece, its score and its type. The first two columns are
+	// the same as in the output of SentencePiece's spm_export_vocab, and files
+	// produced by spm_export_vocab (without the type column) can be read too.
+	//
+	// Pieces that contain tabs or line breaks, which spm_export_vocab writes
+	// as they are (making its output ambiguous), are written as Go-syntax
+	// quoted strings, with a fourth column "quoted" marking them. All other
+	// pieces, including ones with quotes, are written (and read) verbatim.
+	VocabTSV VocabFormat = iota
+
+	// VocabJSON is a JSON array with an object for each piece, in ID order,
+	// with the fields "id", "piece", "score" and "type".
+	VocabJSON
+)
+
+// Vocabulary returns the pieces of the model's vocabulary, in ID order.
+func (m *Model) Vocabulary() []PieceInfo {
+	vocab := make([]PieceInfo, m.numPieces())
+	for id := range vocab {
+		vocab[id] = m.pieceInfo(id)
+	}
+	return vocab
+}
+
+// WriteVocab writes the model's vocabulary to w in the given format.
+func (m *Model) WriteVocab(w io.Writer, format VocabFormat) error {
+	vocab := m.Vocabulary()
+	switch format {
+	case VocabTSV:
+		bw := bufio.NewWriter(w)
+		for _, p := range vocab {
+			score := strconv.FormatFloat(float64(p.Score), 'g', -1, 32)
+			if strings.ContainsAny(p.Piece, "\t\n\r") {
+				fmt.Fprintf(bw, "%s\t%s\t%s\t%s\n", strconv.Quote(p.Piece), score, p.Type, quotedMarker)
+			} else {
+				fmt.Fprintf(bw, "%s\t%s\t%s\n", p.Piece, score, p.Type)
+			}
+		}
+		return bw.Flush()
+	case VocabJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(vocab)
+	default:
+		return fmt.Errorf("unknown vocabulary format %d", format)
+	}
+}
+
+// ReadVocab reads a vocabulary in the given format, as written by
+// [Model.WriteVocab] (or, for VocabTSV, by spm_export_vocab). Pieces without a
+// type have an empty Type; see [BuildModelProto] for how their type is
+// determined.
+func ReadVocab(r io.Reader, format VocabFormat) ([]PieceInfo, error) {
+	switch format {
+	case VocabTSV:
+		var vocab []PieceInfo
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			line := scanner.Text()
+			fields := strings.Split(line, "\t")
+			if len(fields) < 2 || len(fields) > 4 {
+				return nil, fmt.Errorf("line %d: want 2 to 4 tab-separated fields, got %d", len(vocab)+1, len(fields))
+			}
+			score, err := strconv.ParseFloat(fields[1], 32)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: bad score: %v", len(vocab)+1, err)
+			}
+			piece := fields[0]
+			if len(fields) == 4 {
+				if fields[3] != quotedMarker {
+					return nil, fmt.Errorf("line %d: unknown fourth field %q", len(vocab)+1, fields[3])
+				}
+				if piece, err = strconv.Unquote(piece); err != nil {
+					return nil, fmt.Errorf("line %d: bad quoted piece: %v", len(vocab)+1, err)
+				}
+			}
+			p := PieceInfo{ID: len(vocab), Piece: piece, Score: float32(score)}
+			if len(fields) >= 3 {
+				p.Type = fields[2]
+			}
+			vocab = append(vocab, p)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return vocab, nil
+	case VocabJSON:
+		var vocab []PieceInfo
+		if err := json.NewDecoder(r).Decode(&vocab); err != nil {
+			return nil, err
+		}
+		return vocab, nil
+	default:
+		return nil, fmt.Errorf("unknown vocabulary format %d", format)
+	}
+}
+
+// WriteSettings writes the settings of the model (its model proto without the
+// pieces: the trainer spec, normalizer spec, etc.) to w, in protobuf text
+// format. Along with the vocabulary, it can be used to rebuild the model
+// proto with [BuildModelProto].
+func (m *Model) WriteSettings(w io.Writer) error {
+	settings := proto.Clone(m.proto).(*model.ModelProto)
+	settings.Pieces = nil
+	b, err := prototext.MarshalOptions{Multiline: true}.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// BuildModelProto builds a serialized model proto from a vocabulary and model
+// settings, in the protobuf text format written by [Model.WriteSettings];
+// pieces in the settings are ignored. The result can be loaded with the
+// LoadModel* functions (if its settings are supported by this package), or
+// used with other SentencePiece implementations.
+//
+// The IDs of the pieces must be 0, 1, 2, etc., in order. Pieces with an empty
+// Type get the type SentencePiece's trainer would assign them: UNKNOWN for
+// the trainer spec's unk_piece; CONTROL for its control_symbols, and for its
+// bos_piece, eos_piece and pad_piece if their IDs aren't negative;
+// USER_DEFINED for its user_defined_symbols; BYTE for pieces like "<0x0A>" if
+// byte fallback is enabled; and NORMAL for all other pieces.
+func BuildModelProto(vocab []PieceInfo, settings []byte) ([]byte, error) {
+	if len(vocab) == 0 {
+		return nil, errors.New("empty vocabulary")
+	}
+
+	var mp model.ModelProto
+	if err := prototext.Unmarshal(settings, &mp); err != nil {
+		return nil, fmt.Errorf("unable to parse settings: %v", err)
+	}
+
+	ts := mp.GetTrainerSpec()
+	controlPieces := make(map[string]bool)
+	for _, meta := range []struct {
+		piece string
+		id    int32
+	}{
+		{ts.GetBosPiece(), ts.GetBosId()},
+		{ts.GetEosPiece(), ts.GetEosId()},
+		{ts.GetPadPiece(), ts.GetPadId()},
+	} {
+		if meta.id >= 0 {
+			controlPieces[meta.piece] = true
+		}
+	}
+	for _, sym := range ts.GetControlSymbols() {
+		controlPieces[sym] = true
+	}
+	userDefinedPieces := make(map[string]bool)
+	for _, sym := range ts.GetUserDefinedSymbols() {
+		userDefinedPieces[sym] = true
+	}
+
+	mp.Pieces = make([]*model.ModelProto_SentencePiece, len(vocab))
+	for i, p := range vocab {
+		if p.ID != i {
+			return nil, fmt.Errorf("piece %q has ID %d, want %d", p.Piece, p.ID, i)
+		}
+
+		var pieceType model.ModelProto_SentencePiece_Type
+		switch {
+		case p.Type != "":
+			t, ok := model.ModelProto_SentencePiece_Type_value[p.Type]
+			if !ok {
+				return nil, fmt.Errorf("piece %q has unknown type %q", p.Piece, p.Type)
+			}
+			pieceType = model.ModelProto_SentencePiece_Type(t)
+		case p.Piece == ts.GetUnkPiece():
+			pieceType = model.ModelProto_SentencePiece_UNKNOWN
+		case controlPieces[p.Piece]:
+			pieceType = model.ModelProto_SentencePiece_CONTROL
+		case userDefinedPieces[p.Piece]:
+			pieceType = model.ModelProto_SentencePiece_USER_DEFINED
+		case ts.GetByteFallback() && isBytePiece(p.Piece):
+			pieceType = model.ModelProto_SentencePiece_BYTE
+		default:
+			pieceType = model.ModelProto_SentencePiece_NORMAL
+		}
+
+		mp.Pieces[i] = &model.ModelProto_SentencePiece{
+			Piece: proto.String(p.Piece),
+			Score: proto.Float32(p.Score),
+			Type:  pieceType.Enum(),
+		}
+	}
+
+	return proto.Marshal(&mp)
+}
+
+// quotedMarker is the fourth column of VocabTSV lines whose piece is quoted.
+const quotedMarker = "quoted"
+
+// isBytePiece reports whether piece has the form of a byte piece: "<0xXY>".
+func isBytePiece(piece string) bool {
+	return len(piece) == 6 && strings.HasPrefix(piece, "<0x") && strings.HasSuffix(piece, ">") &&
+		convertHexValue(piece) >= 0
+}
@@ -0,0 +1,216 @@
+package sentencepiece
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestVocabRoundTrip(t *testing.T) {
+	m, err := LoadModelFromPath(modelPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vocab := m.Vocabulary()
+	if len(vocab) != NewProcessorFromModel(m).ModelInfo().VocabularySize {
+		t.Fatalf("got %d pieces in vocabulary", len(vocab))
+	}
+
+	var settings bytes.Buffer
+	if err := m.WriteSettings(&settings); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []VocabFormat{VocabTSV, VocabJSON} {
+		var buf bytes.Buffer
+		if err := m.WriteVocab(&buf, format); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadVocab(&buf, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, vocab) {
+			t.Errorf("format %d: vocabulary differs after round trip", format)
+		}
+
+		data, err := BuildModelProto(got, settings.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		rebuilt, err := LoadModelFromBytes(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rebuilt.Fingerprint() != m.Fingerprint() {
+			t.Errorf("format %d: rebuilt model has a different fingerprint", format)
+		}
+	}
+}
+
+func TestVocabInferTypes(t *testing.T) {
+	m, err := LoadModelFromPath(modelPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var settings bytes.Buffer
+	if err := m.WriteSettings(&settings); err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop the type column, as in the output of spm_export_vocab (but keep
+	// quoted pieces quoted).
+	var buf, tsv bytes.Buffer
+	if err := m.WriteVocab(&buf, VocabTSV); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) == 4 {
+			tsv.WriteString(fields[0] + "\t" + fields[1] + "\t\t" + fields[3] + "\n")
+		} else {
+			tsv.WriteString(fields[0] + "\t" + fields[1] + "\n")
+		}
+	}
+
+	vocab, err := ReadVocab(&tsv, VocabTSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := BuildModelProto(vocab, settings.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := LoadModelFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The inferred types match, except for unused pieces, which the trainer
+	// never produces.
+	for id, p := range rebuilt.Vocabulary() {
+		want := m.pieceInfo(id)
+		if want.Type == "UNUSED" {
+			continue
+		}
+		if p != want {
+			t.Errorf("got piece %v, want %v", p, want)
+		}
+	}
+}
+
+func TestVocabQuotes(t *testing.T) {
+	// Pieces with quotes are read verbatim from spm_export_vocab output, and
+	// round-trip through WriteVocab and ReadVocab; pieces with tabs and line
+	// breaks are quoted.
+	got, err := ReadVocab(strings.NewReader("<unk>\t0\n\"\t-1\n\",\t-2\n\"a\"\t-3\n"), VocabTSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PieceInfo{
+		{ID: 0, Piece: "<unk>"},
+		{ID: 1, Piece: `"`, Score: -1},
+		{ID: 2, Piece: `",`, Score: -2},
+		{ID: 3, Piece: `"a"`, Score: -3},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	want = append(want, PieceInfo{ID: 4, Piece: "a\tb\n", Score: -4})
+	data, err := BuildModelProto(want, []byte("trainer_spec { model_type: BPE }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadModelFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := m.WriteVocab(&buf, VocabTSV); err != nil {
+		t.Fatal(err)
+	}
+	got, err = ReadVocab(&buf, VocabTSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, m.Vocabulary()) {
+		t.Errorf("got %v, want %v", got, m.Vocabulary())
+	}
+}
+
+func TestBuildModelProtoTypes(t *testing.T) {
+	vocab := []PieceInfo{
+		{ID: 0, Piece: "<unk>"},
+		{ID: 1, Piece: "<s>"},
+		{ID: 2, Piece: "</s>"},
+		{ID: 3, Piece: "<pad>"},
+		{ID: 4, Piece: "<ctl>"},
+		{ID: 5, Piece: "<start_of_turn>"},
+		{ID: 6, Piece: "<0x41>"},
+		{ID: 7, Piece: "a"},
+	}
+	settings := `trainer_spec {
+		model_type: BPE
+		pad_id: -1
+		control_symbols: "<ctl>"
+		user_defined_symbols: "<start_of_turn>"
+	}
+	normalizer_spec { add_dummy_prefix: false }`
+	data, err := BuildModelProto(vocab, []byte(settings))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadModelFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, p := range m.Vocabulary() {
+		got = append(got, p.Type)
+	}
+	want := []string{"UNKNOWN", "CONTROL", "CONTROL", "NORMAL", "CONTROL", "USER_DEFINED", "NORMAL", "NORMAL"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got types %v, want %v", got, want)
+	}
+
+	// The user-defined symbol is a single token.
+	proc := NewProcessorFromModel(m)
+	if got := proc.Encode("a<start_of_turn>a"); len(got) != 3 || got[1].ID != 5 {
+		t.Errorf("got tokens %v", got)
+	}
+}
+
+func TestVocabErrors(t *testing.T) {
+	for _, input := range []string{
+		"a\t1.0\tNORMAL\tx\n",
+		"a\n",
+		"a\tnot-a-score\n",
+		"\"a\t1.0\tNORMAL\tquoted\n",
+	} {
+		if _, err := ReadVocab(strings.NewReader(input), VocabTSV); err == nil {
+			t.Errorf("ReadVocab(%q): expected error", input)
+		}
+	}
+
+	vocab := []PieceInfo{{ID: 0, Piece: "<unk>"}, {ID: 1, Piece: "a"}}
+	if _, err := BuildModelProto(vocab, []byte("trainer_spec { model_type: BPE }")); err != nil {
+		t.Errorf("BuildModelProto: %v", err)
+	}
+
+	for _, tt := range []struct {
+		vocab    []PieceInfo
+		settings string
+	}{
+		{nil, ""},
+		{[]PieceInfo{{ID: 1, Piece: "a"}}, ""},
+		{[]PieceInfo{{ID: 0, Piece: "a", Type: "BOGUS"}}, ""},
+		{vocab, "not settings"},
+	} {
+		if _, err := BuildModelProto(tt.vocab, []byte(tt.settings)); err == nil {
+			t.Errorf("BuildModelProto(%v, %q): expected error", tt.vocab, tt.settings)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package sentencepiece
+
+// Encoding for the WORD and CHAR model types, which are much simpler than BPE:
+// a CHAR model has a token for each character of the normalized text, and a
+// WORD model has a token for each word, split at whitespace. In both, the
+// user-defined symbols of the model are tokens of their own, and characters
+// or words that aren't in the vocabulary are encoded with byte fallback if
+// the model has it, or as the unknown token otherwise.
+
+// encodeChars encodes the symbols of symList (the initial symbols of text, as
+// produced by Encode) with a CHAR model: each symbol is a token.
+func (proc *Processor) encodeChars(symList []symListElem) []Token {
+	tokens := make([]Token, 0, len(symList))
+	for _, sym := range symList {
+		tokens = proc.appendSymbolToken(tokens, sym.symbol)
+	}
+	return tokens
+}
+
+// encodeWordModel encodes text, whose initial symbols (as produced by Encode)
+// are in symList, with a WORD model. Text is split into words like in
+// SplitIntoWords of the C++ library: a word starts at each whitespace
+// separator, or ends after it for models that treat whitespace as a suffix.
+// With allow_whitespace_only_pieces, a run of separators stays in a single
+// word rather than being split into separate ones. Each user-defined symbol
+// is a word of its own.
+func (proc *Processor) encodeWordModel(text string, symList []symListElem) []Token {
+	space := proc.model.normalizer.whitespace()
+	suffix := proc.model.normalizer.treatWhitespaceAsSuffix
+	allowSpaceOnly := proc.model.proto.GetTrainerSpec().GetAllowWhitespaceOnlyPieces()
+
+	var tokens []Token
+	wordStart := 0
+
+	// endWord appends the token of the word that ends at end (if it's not
+	// empty), and starts a new word there.
+	endWord := func(end int) {
+		if end > wordStart {
+			word := text[wordStart:end]
+			id := proc.symbolToID(word)
+			if proc.allowedIDs != nil && !proc.allowedIDs[id] {
+				// Words outside the restricted vocabulary can't be split
+				// into smaller pieces, so they're unknown.
+				id = proc.model.unknownID
+			}
+			tokens = proc.appendTokenWithID(tokens, word, id)
+		}
+		wordStart = end
+	}
+
+	// inSpaces is set while in a run of separators; with whitespace as a
+	// prefix, the start of the text (or of the text after a user-defined
+	// symbol) counts as one.
+	inSpaces := !suffix
+	offset := 0
+	for _, sym := range symList {
+		end := offset + len(sym.symbol)
+		if sym.noMerge {
+			endWord(offset)
+			endWord(end)
+			inSpaces = !suffix
+			offset = end
+			continue
+		}
+
+		isSpace := sym.symbol == space
+		if suffix {
+			if isSpace {
+				inSpaces = true
+			} else if inSpaces {
+				if allowSpaceOnly {
+					endWord(offset)
+				}
+				inSpaces = false
+			}
+			if isSpace && !allowSpaceOnly {
+				endWord(end)
+			}
+		} else {
+			if isSpace && (!inSpaces || !allowSpaceOnly) {
+				endWord(offset)
+				inSpaces = true
+			}
+			if !isSpace {
+				inSpaces = false
+			}
+		}
+		offset = end
+	}
+	endWord(len(text))
+	return tokens
+}
@@ -0,0 +1,142 @@
+package sentencepiece
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/eliben/go-sentencepiece/internal/model"
+	"google.golang.org/protobuf/proto"
+)
+
+// newModelOfType creates a model from the test model proto, with its model
+// type changed to modelType; modify may change the proto further.
+func newModelOfType(t *testing.T, modelType model.TrainerSpec_ModelType, modify func(mp *model.ModelProto)) *Model {
+	t.Helper()
+	mp := loadModelProto(t)
+	mp.TrainerSpec.ModelType = modelType.Enum()
+	if modify != nil {
+		modify(mp)
+	}
+	m, err := newModel(mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// wantTokens returns the tokens proc should encode symbols to, each being a
+// single token, or byte tokens if it's not in the vocabulary.
+func wantTokens(proc *Processor, symbols ...string) []Token {
+	var tokens []Token
+	for _, sym := range symbols {
+		if id, ok := proc.PieceToID(sym); ok {
+			tokens = append(tokens, Token{ID: id, Text: sym})
+			continue
+		}
+		for i := 0; i < len(sym); i++ {
+			tokens = append(tokens, proc.model.byte2Token[sym[i]])
+		}
+	}
+	return tokens
+}
+
+func TestCharModel(t *testing.T) {
+	m := newModelOfType(t, model.TrainerSpec_CHAR, nil)
+	proc := NewProcessorFromModel(m)
+
+	text := "hi <td>wörld\n𝔘"
+	want := wantTokens(proc, "h", "i", "▁", "<td>", "w", "ö", "r", "l", "d", "\n", "𝔘")
+	got := proc.Encode(text)
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !slices.ContainsFunc(got, func(tok Token) bool { return proc.isByteID(tok.ID) }) {
+		t.Errorf("got %v, want byte fallback for %q", got, "𝔘")
+	}
+	if decoded := proc.DecodeTokens(got); decoded != text {
+		t.Errorf("got decoded %q, want %q", decoded, text)
+	}
+	if got := NewProcessorFromModel(m, WithWordCache(100)).Encode(text); !slices.Equal(got, want) {
+		t.Errorf("got %v with word cache, want %v", got, want)
+	}
+
+	// Without byte fallback, unknown characters are encoded as the unknown
+	// token.
+	m = newModelOfType(t, model.TrainerSpec_CHAR, func(mp *model.ModelProto) {
+		mp.TrainerSpec.ByteFallback = proto.Bool(false)
+		mp.Pieces = slices.DeleteFunc(mp.Pieces, func(p *model.ModelProto_SentencePiece) bool {
+			return p.GetType() == model.ModelProto_SentencePiece_BYTE
+		})
+	})
+	proc = NewProcessorFromModel(m)
+	got = proc.Encode("a𝔘")
+	want = []Token{wantTokens(proc, "a")[0], {ID: proc.ModelInfo().UnknownID, Text: "𝔘"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestWordModel(t *testing.T) {
+	text := "hello  world<td>again 𝔘"
+
+	var tests = []struct {
+		name                   string
+		suffix, allowSpaceOnly bool
+		words                  []string
+	}{
+		{"prefix", false, false, []string{"hello", "▁", "▁world", "<td>", "again", "▁𝔘"}},
+		{"prefix whitespace-only", false, true, []string{"hello", "▁▁world", "<td>", "again", "▁𝔘"}},
+		{"suffix", true, false, []string{"hello▁", "▁", "world", "<td>", "again▁", "𝔘"}},
+		{"suffix whitespace-only", true, true, []string{"hello▁▁", "world", "<td>", "again▁", "𝔘"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newModelOfType(t, model.TrainerSpec_WORD, func(mp *model.ModelProto) {
+				mp.TrainerSpec.TreatWhitespaceAsSuffix = proto.Bool(tt.suffix)
+				mp.TrainerSpec.AllowWhitespaceOnlyPieces = proto.Bool(tt.allowSpaceOnly)
+
+				// Runs of separators are words rather than user-defined
+				// symbols.
+				for _, piece := range mp.Pieces {
+					if strings.Trim(piece.GetPiece(), "▁") == "" {
+						piece.Type = model.ModelProto_SentencePiece_NORMAL.Enum()
+					}
+				}
+			})
+			proc := NewProcessorFromModel(m)
+			want := wantTokens(proc, tt.words...)
+			if got := proc.Encode(text); !slices.Equal(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+
+	// Words in the vocabulary are single tokens, and words outside the
+	// restricted vocabulary are not.
+	m := newModelOfType(t, model.TrainerSpec_WORD, nil)
+	proc := NewProcessorFromModel(m)
+	var word string
+	for _, piece := range m.Vocabulary() {
+		if piece.Type == "NORMAL" && len([]rune(piece.Piece)) > 2 {
+			word = piece.Piece
+			break
+		}
+	}
+	if word == "" {
+		t.Skip("no multi-rune pieces")
+	}
+	id, _ := proc.PieceToID(word)
+	text = replaceSeparatorsBySpace(word)
+	got := proc.Encode(text)
+	if want := []Token{{ID: id, Text: word}}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if decoded := proc.DecodeTokens(got); decoded != text {
+		t.Errorf("got decoded %q, want %q", decoded, text)
+	}
+	restricted := NewProcessorFromModel(m, WithVocabulary(nil))
+	if got := restricted.Encode(text); len(got) != len(word) {
+		t.Errorf("got %v, want byte tokens for %q", got, word)
+	}
+}